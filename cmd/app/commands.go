@@ -0,0 +1,129 @@
+package main
+
+import (
+	"XTechProject/internal/models"
+	"XTechProject/internal/services"
+	"XTechProject/pkg/migrate"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const usage = `usage:
+	%[1]s - run the server
+	%[1]s migrate up|down|status
+	%[1]s backfill fiat --from YYYY-MM-DD [--to YYYY-MM-DD] [--source cbr] [--delay 1s]
+	%[1]s backfill btc --from TIME [--to TIME] [--symbol BTC-USDT] [--source kucoin] [--interval 1m] [--delay 1s]`
+
+// runCommand runs the commands that need the service
+func runCommand(ctx context.Context, service *services.ManagementService, args []string) error {
+	switch {
+	case len(args) > 1 && args[0] == "backfill" && args[1] == "fiat":
+		return runBackfillFiat(ctx, service, args[2:])
+	case len(args) > 1 && args[0] == "backfill" && args[1] == "btc":
+		return runBackfillBTC(ctx, service, args[2:])
+	default:
+		return fmt.Errorf(usage, os.Args[0])
+	}
+}
+
+func runBackfillFiat(ctx context.Context, service *services.ManagementService, args []string) error {
+	flags := flag.NewFlagSet("backfill fiat", flag.ContinueOnError)
+	from := flags.String("from", "", "first date, YYYY-MM-DD")
+	to := flags.String("to", time.Now().Format(time.RFC3339[:10]), "last date, YYYY-MM-DD")
+	source := flags.String("source", services.FiatSourceCBR, "fiat source with history")
+	delay := flags.Duration("delay", time.Second, "pause between requests to the source")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	fromTime, err := time.Parse(time.RFC3339[:10], *from)
+	if err != nil {
+		return fmt.Errorf("--from: %w", err)
+	}
+	toTime, err := time.Parse(time.RFC3339[:10], *to)
+	if err != nil {
+		return fmt.Errorf("--to: %w", err)
+	}
+	created, err := service.BackfillFiat(ctx, *source, fromTime, toTime, *delay)
+	log.Printf("backfill fiat: %d day(s) stored", created)
+	return err
+}
+
+func runBackfillBTC(ctx context.Context, service *services.ManagementService, args []string) error {
+	flags := flag.NewFlagSet("backfill btc", flag.ContinueOnError)
+	from := flags.String("from", "", "start, RFC3339 or YYYY-MM-DD")
+	to := flags.String("to", time.Now().Format(time.RFC3339), "end, RFC3339 or YYYY-MM-DD, exclusive")
+	params := services.BTCBackfill{}
+	flags.StringVar(&params.Symbol, "symbol", models.SymbolBTCUSDT, "tracked pair")
+	flags.StringVar(&params.Source, "source", services.SourceKuCoin, "price source with klines: kucoin, binance")
+	flags.StringVar(&params.Interval, "interval", "1m", "kline size: 1m, 5m, 15m, 1h, 1d")
+	flags.DurationVar(&params.Delay, "delay", time.Second, "pause between requests to the source")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	var err error
+	if params.From, err = parseFlagTime(*from); err != nil {
+		return fmt.Errorf("--from: %w", err)
+	}
+	if params.To, err = parseFlagTime(*to); err != nil {
+		return fmt.Errorf("--to: %w", err)
+	}
+	params.Symbol = strings.ToUpper(params.Symbol)
+	created, err := service.BackfillBTC(ctx, params)
+	log.Printf("backfill btc: %d record(s) stored", created)
+	return err
+}
+
+// parseFlagTime accepts RFC3339 or YYYY-MM-DD
+func parseFlagTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339[:10], value)
+}
+
+// runMigrate runs migrate up|down|status
+func runMigrate(migrator *migrate.Migrator, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s migrate up|down|status", os.Args[0])
+	}
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			log.Printf("applied %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			log.Println("no pending migrations")
+		}
+	case "down":
+		m, err := migrator.Down()
+		if err != nil {
+			return err
+		}
+		log.Printf("rolled back %04d_%s", m.Version, m.Name)
+	case "status":
+		version, err := migrator.Version()
+		if err != nil {
+			return err
+		}
+		pending, err := migrator.Pending()
+		if err != nil {
+			return err
+		}
+		log.Printf("version %d, latest %d", version, migrator.Latest())
+		for _, m := range pending {
+			log.Printf("pending %04d_%s", m.Version, m.Name)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+	}
+	return nil
+}
@@ -6,9 +6,22 @@ import (
 	"XTechProject/internal/server"
 	"XTechProject/internal/services"
 	"XTechProject/pkg/postgres"
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	// cron schedules use timezones the image may not have
+	_ "time/tzdata"
 )
 
+// shutdownTimeout is how long running requests and workers may take after SIGTERM,
+// docker kills the container 10 seconds after it
+const shutdownTimeout = 8 * time.Second
+
 func main() {
 	// init config
 	cfg, err := config.New()
@@ -20,18 +33,73 @@ func main() {
 	if err != nil {
 		log.Fatalf("error with starting postgres, err: %s", err.Error())
 	}
-	// init repository and create/check tables
+	migrator, err := repository.NewMigrator(db)
+	if err != nil {
+		log.Fatalf("error with loading migrations, err: %s", err.Error())
+	}
+	// ./server migrate up|down|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(migrator, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	// the schema is migrated before the server is started
+	pending, err := migrator.Pending()
+	if err != nil {
+		log.Fatalf("error with checking migrations, err: %s", err.Error())
+	}
+	if len(pending) != 0 {
+		log.Fatalf("database schema is behind by %d migration(s), run: %s migrate up", len(pending), os.Args[0])
+	}
+	// init repository
 	repo := repository.New(db)
 	// init services and start workers
-	service := services.NewManagementService(repo, cfg)
-	// run workers
-	go service.RunWorkers()
-	//init server
-	srv := server.NewServer(cfg.PORT, service)
+	service, err := services.NewManagementService(repo, cfg)
 	if err != nil {
-		log.Fatalf("error with starting server, err: %s", err.Error())
+		log.Fatalf("error with creating service, err: %s", err.Error())
+	}
+	// SIGINT/SIGTERM stop the tickers and the server
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// ./server backfill fiat --from 2023-01-01
+	if len(os.Args) > 1 {
+		if err := runCommand(ctx, service, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
+	// run workers
+	workersStopped := make(chan struct{})
+	go func() {
+		service.RunWorkers(ctx)
+		close(workersStopped)
+	}()
+	//init server
+	srv := server.NewServer(cfg.PORT, cfg.AdminToken, service)
 	// run server
 	log.Println("Listening and serving: http://localhost:" + cfg.PORT)
-	log.Panic(srv.ListenAndServe())
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("error with serving, err: %s", err.Error())
+			stop()
+		}
+	}()
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down")
+	// in-flight requests and db writes get shutdownTimeout to finish
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("error with shutting down server, err: %s", err.Error())
+	}
+	<-workersStopped
+	if err := service.Shutdown(shutdownCtx); err != nil {
+		log.Printf("error with waiting for workers, err: %s", err.Error())
+	}
+	if err := db.DB.Close(); err != nil {
+		log.Printf("error with closing postgres, err: %s", err.Error())
+	}
+	log.Println("Stopped")
 }
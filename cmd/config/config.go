@@ -1,15 +1,79 @@
 package config
 
-import "github.com/kelseyhightower/envconfig"
+import (
+	"fmt"
+	"github.com/kelseyhightower/envconfig"
+	"net/url"
+	"os"
+	"time"
+)
 
 type Config struct {
 	DB struct {
 		URL string `envconfig:"DATABASE_URL" default:"postgres://postgres:strongPassword1@db:5432/postgres?sslmode=disable"`
 	}
 	PORT string `envconfig:"PORT" default:"8000"`
+	// AdminToken is the bearer token of /api/admin endpoints, they are disabled when it is empty
+	AdminToken string `envconfig:"ADMIN_TOKEN"`
+	// Symbols are the crypto pairs quoted in USDT the workers track, BTC-USDT is served by /api/btcusdt
+	Symbols []string `envconfig:"SYMBOLS" default:"BTC-USDT"`
+	Price   struct {
+		// Sources are the exchanges BTCWorker polls: kucoin, binance, coinbase, kraken
+		Sources []string `envconfig:"PRICE_SOURCES" default:"kucoin"`
+		// MaxDeviation is the allowed distance from the median as a fraction, quotes beyond it are dropped
+		MaxDeviation float64 `envconfig:"PRICE_MAX_DEVIATION" default:"0.02"`
+		// MinSources is how many accepted quotes are needed to store a price
+		MinSources int `envconfig:"PRICE_MIN_SOURCES" default:"1"`
+	}
+	Fiat struct {
+		// Sources are the providers FiatWorker polls: cbr, ecb, json. The first one is served by the API
+		Sources []string `envconfig:"FIAT_SOURCES" default:"cbr"`
+		// JSONBase is the base currency of the json source
+		JSONBase string `envconfig:"FIAT_JSON_BASE" default:"USD"`
+		// ReprocessDay prices all BTC records of the effective date again when new rates of the primary source
+		// are stored, otherwise only the latest records are
+		ReprocessDay bool `envconfig:"FIAT_REPROCESS_DAY" default:"false"`
+	}
+	// Precision is how many digits after the point amounts have in the output, btc_to_fiat and conversions.
+	// Currencies overrides it per currency like "JPY:0,ETH:6".
+	Precision struct {
+		Fiat       int32            `envconfig:"PRECISION_FIAT" default:"2"`
+		Crypto     int32            `envconfig:"PRECISION_CRYPTO" default:"8"`
+		Currencies map[string]int32 `envconfig:"PRECISION"`
+	}
+	// Schedule is when the workers run: a duration like 10s or a cron expression "minute hour day month weekday".
+	// Every run is delayed by a random duration up to its jitter.
+	Schedule struct {
+		BTC        string        `envconfig:"SCHEDULE_BTC" default:"10s"`
+		BTCJitter  time.Duration `envconfig:"SCHEDULE_BTC_JITTER" default:"0s"`
+		Fiat       string        `envconfig:"SCHEDULE_FIAT" default:"30 15 * * MON-FRI"`
+		FiatJitter time.Duration `envconfig:"SCHEDULE_FIAT_JITTER" default:"1m"`
+		// Timezone of cron expressions, CBR publishes rates at Moscow time
+		Timezone string `envconfig:"SCHEDULE_TZ" default:"Europe/Moscow"`
+	}
+	// Fetch is how the sources call upstream APIs
+	Fetch struct {
+		// Timeout of one request, Timeouts overrides it per source like "cbr:30s,kraken:5s"
+		Timeout  time.Duration            `envconfig:"FETCH_TIMEOUT" default:"10s"`
+		Timeouts map[string]time.Duration `envconfig:"FETCH_TIMEOUTS"`
+		// Retries of a failed request, the delay between them starts at Backoff and doubles up to MaxBackoff
+		Retries    int           `envconfig:"FETCH_RETRIES" default:"3"`
+		Backoff    time.Duration `envconfig:"FETCH_BACKOFF" default:"500ms"`
+		MaxBackoff time.Duration `envconfig:"FETCH_MAX_BACKOFF" default:"10s"`
+		// BreakerFailures failed requests in a row stop calling the source for BreakerCooldown
+		BreakerFailures int           `envconfig:"FETCH_BREAKER_FAILURES" default:"5"`
+		BreakerCooldown time.Duration `envconfig:"FETCH_BREAKER_COOLDOWN" default:"1m"`
+	}
 	URLs struct {
-		BTCUSDT string `envconfig:"GET_BTCUSDT" default:"https://api.kucoin.com/api/v1/market/stats?symbol=BTC-USDT"`
-		Fiat    string `envconfig:"GET_FIAT" default:"http://www.cbr.ru/scripts/XML_daily.asp"`
+		KuCoin   string `envconfig:"GET_KUCOIN" default:"https://api.kucoin.com"`
+		Binance  string `envconfig:"GET_BINANCE" default:"https://api.binance.com"`
+		Coinbase string `envconfig:"GET_COINBASE" default:"https://api.exchange.coinbase.com"`
+		Kraken   string `envconfig:"GET_KRAKEN" default:"https://api.kraken.com"`
+		Fiat     string `envconfig:"GET_FIAT" default:"http://www.cbr.ru/scripts/XML_daily.asp"`
+		ECB      string `envconfig:"GET_ECB" default:"https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"`
+		FiatJSON string `envconfig:"GET_FIAT_JSON" default:"https://api.exchangerate.host/latest?base=USD"`
+		// BTCUSDT is the deprecated KuCoin stats URL, its host is used as KuCoin when GET_KUCOIN is not set
+		BTCUSDT string `envconfig:"GET_BTCUSDT"`
 	}
 }
 
@@ -19,5 +83,12 @@ func New() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if _, ok := os.LookupEnv("GET_KUCOIN"); !ok && cfg.URLs.BTCUSDT != "" {
+		link, err := url.Parse(cfg.URLs.BTCUSDT)
+		if err != nil || link.Scheme == "" || link.Host == "" {
+			return nil, fmt.Errorf("unexpected GET_BTCUSDT %q, use GET_KUCOIN", cfg.URLs.BTCUSDT)
+		}
+		cfg.URLs.KuCoin = link.Scheme + "://" + link.Host
+	}
 	return &cfg, nil
 }
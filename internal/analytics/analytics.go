@@ -0,0 +1,172 @@
+// Package analytics derives indicator series from price series: moving averages, volatility and drawdown.
+//
+// The series are computed over periods, the points of the input, so gaps in the input are not filled.
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxPeriod limits how many points an indicator looks back
+const MaxPeriod = 1000
+
+const (
+	// places are the digits after the point kept by divisions and the steps of EMA
+	places = 16
+	// floatPlaces are the digits after the point of the indicators computed in float64
+	floatPlaces = 12
+)
+
+var (
+	ErrUnknownIndicator = errors.New("unknown indicator")
+	ErrUnexpectedPeriod = errors.New("unexpected period")
+)
+
+type (
+	// Point is a value of a series at Time
+	Point struct {
+		Time  time.Time       `json:"time"`
+		Value decimal.Decimal `json:"value"`
+	}
+	// Indicator derives a series from points oldest first.
+	// The first Warmup(period) points only warm it up, the series starts at the point after them.
+	Indicator struct {
+		Compute func(points []Point, period int) []Point
+		// Warmup is how many points before the first output point the indicator needs
+		Warmup func(period int) int
+		// MinPeriod is the shortest period, zero for indicators without a period
+		MinPeriod int
+		// Price indicators are in the unit of the input, the others are fractions
+		Price bool
+		// Peak indicators depend on the highest value of all points before the series,
+		// it can be passed as a point before the first one instead of the whole history
+		Peak bool
+	}
+)
+
+var indicators = map[string]Indicator{
+	"sma":        {Compute: SMA, Warmup: func(period int) int { return period - 1 }, MinPeriod: 1, Price: true},
+	"ema":        {Compute: EMA, Warmup: func(period int) int { return period - 1 }, MinPeriod: 1, Price: true},
+	"volatility": {Compute: Volatility, Warmup: func(period int) int { return period }, MinPeriod: 2},
+	"drawdown":   {Compute: func(points []Point, _ int) []Point { return Drawdown(points) }, Warmup: func(int) int { return 0 }, Peak: true},
+}
+
+// Get returns the indicator by name and checks the period for it, indicators without a period ignore it
+func Get(name string, period int) (Indicator, error) {
+	indicator, ok := indicators[strings.ToLower(name)]
+	if !ok {
+		return Indicator{}, fmt.Errorf("%w: %q, use %s", ErrUnknownIndicator, name, strings.Join(Names(), ", "))
+	}
+	if indicator.MinPeriod != 0 && (period < indicator.MinPeriod || period > MaxPeriod) {
+		return Indicator{}, fmt.Errorf("%w: %d, %s needs %d..%d", ErrUnexpectedPeriod, period, name, indicator.MinPeriod, MaxPeriod)
+	}
+	return indicator, nil
+}
+
+// Names returns the names of the indicators sorted
+func Names() []string {
+	names := make([]string, 0, len(indicators))
+	for name := range indicators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SMA is the simple moving average of period points, it starts at the point that completes the first period
+func SMA(points []Point, period int) []Point {
+	if period < 1 || len(points) < period {
+		return []Point{}
+	}
+	res := make([]Point, 0, len(points)-period+1)
+	n := decimal.NewFromInt(int64(period))
+	sum := decimal.Zero
+	for i, p := range points {
+		sum = sum.Add(p.Value)
+		if i >= period {
+			sum = sum.Sub(points[i-period].Value)
+		}
+		if i >= period-1 {
+			res = append(res, Point{Time: p.Time, Value: sum.DivRound(n, places)})
+		}
+	}
+	return res
+}
+
+// EMA is the exponential moving average with the smoothing 2/(period+1), it is seeded with the SMA of the first period
+func EMA(points []Point, period int) []Point {
+	if period < 1 || len(points) < period {
+		return []Point{}
+	}
+	res := make([]Point, 0, len(points)-period+1)
+	alpha := decimal.NewFromInt(2).DivRound(decimal.NewFromInt(int64(period+1)), places)
+	ema := SMA(points[:period], period)[0].Value
+	res = append(res, Point{Time: points[period-1].Time, Value: ema})
+	for _, p := range points[period:] {
+		// rounding every step keeps the digits from growing with the series
+		ema = ema.Add(alpha.Mul(p.Value.Sub(ema))).Round(places)
+		res = append(res, Point{Time: p.Time, Value: ema})
+	}
+	return res
+}
+
+// Volatility is the rolling realized volatility, the sample standard deviation of the log returns
+// of the last period points. It is not annualized, it is per point of the series.
+func Volatility(points []Point, period int) []Point {
+	if period < 2 || len(points) <= period {
+		return []Point{}
+	}
+	returns := make([]float64, len(points))
+	for i := 1; i < len(points); i++ {
+		prev, cur := points[i-1].Value.InexactFloat64(), points[i].Value.InexactFloat64()
+		if prev <= 0 || cur <= 0 {
+			returns[i] = math.NaN()
+			continue
+		}
+		returns[i] = math.Log(cur / prev)
+	}
+	res := make([]Point, 0, len(points)-period)
+	for i := period; i < len(points); i++ {
+		window := returns[i-period+1 : i+1]
+		var mean float64
+		for _, r := range window {
+			mean += r
+		}
+		mean /= float64(period)
+		var variance float64
+		for _, r := range window {
+			variance += (r - mean) * (r - mean)
+		}
+		variance /= float64(period - 1)
+		// a window with a non-positive price has no volatility
+		if math.IsNaN(variance) {
+			continue
+		}
+		// the digits beyond the float precision are noise
+		res = append(res, Point{Time: points[i].Time, Value: decimal.NewFromFloat(math.Sqrt(variance)).Round(floatPlaces)})
+	}
+	return res
+}
+
+// Drawdown is the fall of every point from the highest value before it, value/peak - 1, zero at a new peak
+func Drawdown(points []Point) []Point {
+	res := make([]Point, 0, len(points))
+	var peak decimal.Decimal
+	for _, p := range points {
+		if p.Value.GreaterThan(peak) {
+			peak = p.Value
+		}
+		drawdown := decimal.Zero
+		if peak.IsPositive() {
+			drawdown = p.Value.DivRound(peak, places).Sub(decimal.NewFromInt(1))
+		}
+		res = append(res, Point{Time: p.Time, Value: drawdown})
+	}
+	return res
+}
@@ -0,0 +1,79 @@
+package analytics
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+	"time"
+)
+
+func newPoints(values ...string) []Point {
+	start := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	points := make([]Point, 0, len(values))
+	for i, v := range values {
+		points = append(points, Point{Time: start.Add(time.Duration(i) * time.Hour), Value: decimal.RequireFromString(v)})
+	}
+	return points
+}
+
+func requireValues(t *testing.T, expected []string, points []Point) {
+	t.Helper()
+	require.Len(t, points, len(expected))
+	for i, e := range expected {
+		require.Truef(t, decimal.RequireFromString(e).Equal(points[i].Value), "point %d: expected %s, got %s", i, e, points[i].Value)
+	}
+}
+
+func TestSMA(t *testing.T) {
+	points := newPoints("1", "2", "3", "4", "6")
+	sma := SMA(points, 3)
+	requireValues(t, []string{"2", "3", "4.3333333333333333"}, sma)
+	require.Equal(t, points[2].Time, sma[0].Time)
+	require.Empty(t, SMA(points, 6))
+}
+
+func TestEMA(t *testing.T) {
+	// the smoothing of period 3 is 0.5
+	ema := EMA(newPoints("1", "2", "3", "5", "3"), 3)
+	requireValues(t, []string{"2", "3.5", "3.25"}, ema)
+	requireValues(t, []string{"1", "2"}, EMA(newPoints("1", "2"), 1))
+	require.Empty(t, EMA(newPoints("1"), 2))
+}
+
+func TestVolatility(t *testing.T) {
+	// the same return every point has no volatility
+	requireValues(t, []string{"0", "0"}, Volatility(newPoints("100", "110", "121", "133.1"), 2))
+
+	vol := Volatility(newPoints("100", "110", "99"), 2)
+	require.Len(t, vol, 1)
+	r1, r2 := math.Log(1.1), math.Log(0.9)
+	mean := (r1 + r2) / 2
+	expected := math.Sqrt((r1-mean)*(r1-mean) + (r2-mean)*(r2-mean))
+	require.InDelta(t, expected, vol[0].Value.InexactFloat64(), 1e-12)
+	require.Empty(t, Volatility(newPoints("1", "2"), 2))
+}
+
+func TestDrawdown(t *testing.T) {
+	requireValues(t, []string{"0", "0", "-0.25", "-0.5", "0"}, Drawdown(newPoints("100", "200", "150", "100", "250")))
+	require.Empty(t, Drawdown(nil))
+}
+
+func TestGet(t *testing.T) {
+	indicator, err := Get("EMA", 20)
+	require.NoError(t, err)
+	require.True(t, indicator.Price)
+	require.Equal(t, 19, indicator.Warmup(20))
+	_, err = Get("drawdown", 0)
+	require.NoError(t, err)
+
+	_, err = Get("rsi", 14)
+	require.ErrorIs(t, err, ErrUnknownIndicator)
+	_, err = Get("sma", 0)
+	require.ErrorIs(t, err, ErrUnexpectedPeriod)
+	_, err = Get("volatility", 1)
+	require.ErrorIs(t, err, ErrUnexpectedPeriod)
+	_, err = Get("ema", MaxPeriod+1)
+	require.ErrorIs(t, err, ErrUnexpectedPeriod)
+	require.Equal(t, []string{"drawdown", "ema", "sma", "volatility"}, Names())
+}
@@ -0,0 +1,92 @@
+package fetch
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half-open"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Breaker opens after threshold failures in a row and rejects calls for cooldown.
+// After the cooldown one trial call is let through, its result closes or opens the breaker again.
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     string
+	failures  int
+	openedAt  time.Time
+	// trial is set while the half-open trial call is running
+	trial bool
+	now   func() time.Time
+}
+
+// NewBreaker returns a closed breaker, threshold 0 never opens it
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{threshold: threshold, cooldown: cooldown, state: StateClosed, now: time.Now}
+}
+
+// Allow returns ErrCircuitOpen when the call must not be made
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = StateHalfOpen
+	case StateHalfOpen:
+		if b.trial {
+			return ErrCircuitOpen
+		}
+	default:
+		return nil
+	}
+	b.trial = true
+	return nil
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = StateClosed
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trial = false
+	if b.state == StateHalfOpen || (b.threshold > 0 && b.failures >= b.threshold) {
+		b.state = StateOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Cancel ends a call that tells nothing about the upstream, like one canceled by its context
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// State returns the state, the failures in a row and when an open breaker lets a trial call through
+func (b *Breaker) State() (string, int, *time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != StateOpen {
+		return b.state, b.failures, nil
+	}
+	until := b.openedAt.Add(b.cooldown)
+	return b.state, b.failures, &until
+}
@@ -0,0 +1,159 @@
+// Package fetch makes GET requests to upstream APIs with timeouts, retries and a circuit breaker.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	Options struct {
+		// Timeout limits one attempt including reading the body, 0 is no limit
+		Timeout time.Duration
+		// Retries is how many times a failed request is repeated
+		Retries int
+		// Backoff is the delay before the first retry, it doubles up to MaxBackoff
+		Backoff    time.Duration
+		MaxBackoff time.Duration
+		// BreakerFailures failed requests in a row open the breaker for BreakerCooldown, 0 disables it
+		BreakerFailures int
+		BreakerCooldown time.Duration
+	}
+	// Client is safe for concurrent use. A nil *Client makes single requests without a timeout.
+	Client struct {
+		http    *http.Client
+		opts    Options
+		breaker *Breaker
+
+		mu      sync.Mutex
+		lastErr error
+		rnd     *rand.Rand
+	}
+	// Status is the breaker state of a client, OpenUntil is set for an open breaker
+	Status struct {
+		State     string     `json:"state"`
+		Failures  int        `json:"failures"`
+		OpenUntil *time.Time `json:"open_until,omitempty"`
+		LastError string     `json:"last_error,omitempty"`
+	}
+	// StatusError is returned for responses with non 2xx status codes
+	StatusError struct {
+		Code int
+	}
+)
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http.Get() status code: %d", e.Code)
+}
+
+func New(opts Options) *Client {
+	return &Client{
+		http:    &http.Client{Timeout: opts.Timeout},
+		opts:    opts,
+		breaker: NewBreaker(opts.BreakerFailures, opts.BreakerCooldown),
+		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Get returns a response with 2xx status code, the caller closes its body.
+// Network errors, 5xx and 429 responses are retried, a request that failed all its attempts
+// counts as one failure for the breaker.
+func (c *Client) Get(ctx context.Context, link string) (*http.Response, error) {
+	if c == nil {
+		return get(ctx, http.DefaultClient, link)
+	}
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := get(ctx, c.http, link)
+		if err == nil {
+			c.breaker.Success()
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			c.breaker.Cancel()
+			return nil, err
+		}
+		if attempt >= c.opts.Retries || !retryable(err) {
+			c.failed(err)
+			return nil, err
+		}
+		timer := time.NewTimer(c.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			c.breaker.Cancel()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) Status() Status {
+	if c == nil {
+		return Status{State: StateClosed}
+	}
+	var s Status
+	s.State, s.Failures, s.OpenUntil = c.breaker.State()
+	c.mu.Lock()
+	if c.lastErr != nil {
+		s.LastError = c.lastErr.Error()
+	}
+	c.mu.Unlock()
+	return s
+}
+
+func (c *Client) failed(err error) {
+	c.breaker.Failure()
+	c.mu.Lock()
+	c.lastErr = err
+	c.mu.Unlock()
+}
+
+// backoff doubles the delay with every attempt, a random half of it spreads the retries of clients
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.opts.Backoff << uint(attempt)
+	if d <= 0 || (c.opts.MaxBackoff > 0 && d > c.opts.MaxBackoff) {
+		d = c.opts.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return d/2 + time.Duration(c.rnd.Int63n(int64(d/2)+1))
+}
+
+func get(ctx context.Context, client *http.Client, link string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequest() err: %w", err)
+	}
+	// NOTE: need to close resp
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http.Get() err: %w", err)
+	}
+	// Success is indicated with 2xx status codes:
+	statusOK := resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !statusOK {
+		resp.Body.Close()
+		return nil, &StatusError{Code: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// retryable is true for network errors and for statuses that may pass on their own
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= 500 || statusErr.Code == http.StatusTooManyRequests
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package fetch
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestUpstream answers with the statuses in order, the last one repeats
+func newTestUpstream(t *testing.T, statuses ...int) (string, *int32) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1))
+		if n > len(statuses) {
+			n = len(statuses)
+		}
+		w.WriteHeader(statuses[n-1])
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, &calls
+}
+
+func testOptions() Options {
+	return Options{Timeout: time.Second, Retries: 2, Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond,
+		BreakerFailures: 2, BreakerCooldown: time.Hour}
+}
+
+func TestGetRetries(t *testing.T) {
+	link, calls := newTestUpstream(t, http.StatusBadGateway, http.StatusTooManyRequests, http.StatusOK)
+	resp, err := New(testOptions()).Get(context.Background(), link)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, int32(3), *calls)
+}
+
+func TestGetDoesNotRetryClientErrors(t *testing.T) {
+	link, calls := newTestUpstream(t, http.StatusNotFound)
+	c := New(testOptions())
+	_, err := c.Get(context.Background(), link)
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, http.StatusNotFound, statusErr.Code)
+	require.Equal(t, int32(1), *calls)
+	require.Equal(t, 1, c.Status().Failures)
+	require.NotEmpty(t, c.Status().LastError)
+}
+
+func TestGetOpensBreaker(t *testing.T) {
+	link, calls := newTestUpstream(t, http.StatusInternalServerError)
+	c := New(testOptions())
+	for i := 0; i < 2; i++ {
+		_, err := c.Get(context.Background(), link)
+		require.Error(t, err)
+	}
+	// every request made all its attempts
+	require.Equal(t, int32(6), *calls)
+	_, err := c.Get(context.Background(), link)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.Equal(t, int32(6), *calls)
+	status := c.Status()
+	require.Equal(t, StateOpen, status.State)
+	require.NotNil(t, status.OpenUntil)
+}
+
+func TestGetCanceled(t *testing.T) {
+	link, _ := newTestUpstream(t, http.StatusServiceUnavailable)
+	opts := testOptions()
+	opts.Backoff, opts.MaxBackoff = time.Hour, time.Hour
+	c := New(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := c.Get(ctx, link)
+	require.Error(t, err)
+	// a canceled request is not the upstream's failure
+	require.Equal(t, 0, c.Status().Failures)
+}
+
+func TestNilClient(t *testing.T) {
+	link, calls := newTestUpstream(t, http.StatusInternalServerError)
+	var c *Client
+	_, err := c.Get(context.Background(), link)
+	require.Error(t, err)
+	require.Equal(t, int32(1), *calls)
+	require.Equal(t, StateClosed, c.Status().State)
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+	require.NoError(t, b.Allow())
+	b.Failure()
+	require.NoError(t, b.Allow())
+	b.Failure()
+	require.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+
+	// one trial call after the cooldown
+	now = now.Add(time.Minute)
+	require.NoError(t, b.Allow())
+	require.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+	state, _, _ := b.State()
+	require.Equal(t, StateHalfOpen, state)
+	// a failed trial opens it again
+	b.Failure()
+	require.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, b.Allow())
+	b.Success()
+	state, failures, until := b.State()
+	require.Equal(t, StateClosed, state)
+	require.Zero(t, failures)
+	require.Nil(t, until)
+}
@@ -2,14 +2,43 @@ package models
 
 import (
 	"encoding/json"
+	"github.com/shopspring/decimal"
 	"time"
 )
 
+const SymbolBTCUSDT = "BTC-USDT"
+
+// BTC is a price of a crypto pair quoted in USDT, the first tracked pair was BTC-USDT
 type BTC struct {
 	ID        int             `json:"id"  db:"id"`
-	InUSDT    float64         `json:"in_usdt" db:"in_usdt"`
-	InRub     float64         `json:"in_rub" db:"in_rub"`
+	Symbol    string          `json:"symbol" db:"symbol"`
+	InUSDT    decimal.Decimal `json:"in_usdt" db:"in_usdt"`
+	InRub     decimal.Decimal `json:"in_rub" db:"in_rub"`
 	Latest    bool            `json:"latest" db:"latest"`
 	CreatedAt *time.Time      `json:"created_at" db:"created_at"`
-	BTCToFiat json.RawMessage `json:"btc_to_fiat" db:"btc_to_fiat"`
+	BTCToFiat json.RawMessage `json:"btc_to_fiat" db:"to_fiat"`
+	Quotes    []SourceQuote   `json:"quotes,omitempty" db:"-"`
+	// Backfilled records are built from exchange klines of Interval, like 1m, instead of live quotes
+	Backfilled bool   `json:"backfilled" db:"backfilled"`
+	Interval   string `json:"interval,omitempty" db:"interval"`
+}
+
+// SourceQuote is a price from one exchange that took part in a BTC record
+type SourceQuote struct {
+	ID        int             `json:"id" db:"id"`
+	QuoteID   int             `json:"quote_id" db:"quote_id"`
+	Source    string          `json:"source" db:"source"`
+	Price     decimal.Decimal `json:"price" db:"price"`
+	Accepted  bool            `json:"accepted" db:"accepted"`
+	CreatedAt *time.Time      `json:"created_at" db:"created_at"`
+}
+
+// Candle is an OHLC bucket of quotes that starts at Time
+type Candle struct {
+	Time  *time.Time      `json:"time" db:"bucket"`
+	Open  decimal.Decimal `json:"open" db:"open"`
+	High  decimal.Decimal `json:"high" db:"high"`
+	Low   decimal.Decimal `json:"low" db:"low"`
+	Close decimal.Decimal `json:"close" db:"close"`
+	Count int             `json:"count" db:"count"`
 }
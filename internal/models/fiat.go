@@ -2,25 +2,74 @@ package models
 
 import (
 	"encoding/json"
+	"fmt"
+	"github.com/shopspring/decimal"
 	"time"
 )
 
 const CharCodeUSD = "USD"
 
+func init() {
+	// amounts stay JSON numbers for the API and the stored currencies, written with their exact digits
+	decimal.MarshalJSONWithoutQuotes = true
+}
+
+// UnitPrice returns the price of one unit of the currency, Nominal must be positive
+func (c Currency) UnitPrice() decimal.Decimal {
+	if c.Nominal == 1 {
+		return c.Val
+	}
+	return c.Val.Div(decimal.NewFromInt(int64(c.Nominal)))
+}
+
+// Rates are currency values by char code, they are scanned from a json object
+type Rates map[string]decimal.Decimal
+
+func (r *Rates) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(src), r)
+	case []byte:
+		return json.Unmarshal(src, r)
+	}
+	return fmt.Errorf("unexpected rates type %T", src)
+}
+
 type (
+	// Fiat is a snapshot of one source, values are in its Base currency.
+	// USDRUB is the price of one USD in Base, it is USD/RUB for the default CBR source.
+	// EffectiveDate is the date the source set the rates for, a source has one record per date.
 	Fiat struct {
-		ID         int             `json:"id"  db:"id"`
-		Latest     bool            `json:"latest" db:"latest"`
-		CreatedAt  *time.Time      `json:"created_at" db:"created_at"`
-		USDRUB     float64         `json:"usd_rub" db:"usd_rub"`
-		Currencies json.RawMessage `json:"currencies" db:"currencies"`
+		ID            int             `json:"id"  db:"id"`
+		Source        string          `json:"source" db:"source"`
+		Base          string          `json:"base" db:"base"`
+		Latest        bool            `json:"latest" db:"latest"`
+		CreatedAt     *time.Time      `json:"created_at" db:"created_at"`
+		EffectiveDate *time.Time      `json:"effective_date" db:"effective_date"`
+		USDRUB        decimal.Decimal `json:"usd_rub" db:"usd_rub"`
+		Currencies    json.RawMessage `json:"currencies" db:"currencies"`
+		// Rates are the values of Currencies by char code, only history rows have them
+		Rates Rates `json:"-" db:"rates"`
+	}
+	// CurrencyPoint is the value of a currency on Date, the effective date of its rates.
+	// Change is against the previous point for the same nominal, it is null for the first point.
+	CurrencyPoint struct {
+		Date      *time.Time          `json:"date" db:"date"`
+		Nominal   int                 `json:"nominal" db:"nominal"`
+		Value     decimal.Decimal     `json:"value" db:"value"`
+		Change    decimal.NullDecimal `json:"change" db:"change"`
+		ChangePct decimal.NullDecimal `json:"change_pct" db:"change_pct"`
 	}
+	// Currency is Nominal units of CharCode priced Val in the base of their Fiat
 	Currency struct {
-		ID       string  `json:"id"  db:"id"`
-		Nominal  int     `json:"nominal" db:"nominal"`
-		Name     string  `json:"name" db:"name"`
-		Val      float64 `json:"value" db:"value"`
-		CharCode string  `json:"char_code" db:"char_code"`
-		NumCode  string  `json:"num_code" db:"num_code"`
+		ID       string          `json:"id"  db:"id"`
+		Nominal  int             `json:"nominal" db:"nominal"`
+		Name     string          `json:"name" db:"name"`
+		Val      decimal.Decimal `json:"value" db:"value"`
+		CharCode string          `json:"char_code" db:"char_code"`
+		NumCode  string          `json:"num_code" db:"num_code"`
 	}
 )
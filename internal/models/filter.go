@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+type (
+	// HistoryFilter selects a page of history, zero Limit means no limit
+	HistoryFilter struct {
+		Limit   int
+		Offset  int
+		OrderBy string
+		From    *time.Time
+		To      *time.Time
+		// After and Before keep rows strictly after or before the key in (time, id) order,
+		// the time is created_at of BTC and effective_date of fiat
+		After  *Keyset
+		Before *Keyset
+		// Codes limits the currencies of fiat history, nil keeps all of them
+		Codes []string
+	}
+	// CurrencyHistoryFilter selects the rates of a currency, From and To are dates inclusive.
+	// Bucket is the date_trunc field of downsampling like day or week, the last rates of a bucket are kept.
+	CurrencyHistoryFilter struct {
+		CharCode string
+		Bucket   string
+		From     *time.Time
+		To       *time.Time
+		Limit    int
+		Offset   int
+	}
+	Keyset struct {
+		Time time.Time
+		ID   int
+	}
+)
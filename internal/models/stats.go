@@ -0,0 +1,17 @@
+package models
+
+import "github.com/shopspring/decimal"
+
+// Stats are the aggregates of the values in a window, First and Last are the oldest and the newest values.
+// ChangePct is Change in percent of First. The values are null without samples, Stddev also with one sample.
+type Stats struct {
+	Count     int                 `json:"count" db:"count"`
+	Min       decimal.NullDecimal `json:"min" db:"min"`
+	Max       decimal.NullDecimal `json:"max" db:"max"`
+	Mean      decimal.NullDecimal `json:"mean" db:"mean"`
+	Stddev    decimal.NullDecimal `json:"stddev" db:"stddev"`
+	First     decimal.NullDecimal `json:"first" db:"first"`
+	Last      decimal.NullDecimal `json:"last" db:"last"`
+	Change    decimal.NullDecimal `json:"change" db:"change"`
+	ChangePct decimal.NullDecimal `json:"change_pct" db:"change_pct"`
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"XTechProject/pkg/migrate"
+	"XTechProject/pkg/postgres"
+	"embed"
+	"io/fs"
+)
+
+// Migrations are the schema versions of the database, a new version is a pair of
+// NNNN_name.up.sql and NNNN_name.down.sql files in the migrations directory
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+func Migrations() fs.FS {
+	sub, _ := fs.Sub(migrations, "migrations")
+	return sub
+}
+
+func NewMigrator(driver *postgres.Postgres) (*migrate.Migrator, error) {
+	return migrate.New(driver.DB, Migrations())
+}
@@ -0,0 +1,4 @@
+DROP TABLE if exists source_quotes;
+DROP TABLE if exists quotes;
+DROP TABLE if exists assets;
+DROP TABLE if exists fiat;
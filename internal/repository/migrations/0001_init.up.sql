@@ -0,0 +1,63 @@
+-- the schema as it was created by Repository.CreateTablesIfTheyNotExist,
+-- every statement is safe to run on a database that already has it
+
+CREATE TABLE if not exists fiat
+(
+    id         bigserial                primary key,
+    currencies jsonb                    not null,
+    usd_rub    decimal(8, 4)            not null,
+    created_at timestamp with time zone not null,
+    latest     boolean                  not null
+);
+-- rates from other sources than CBR
+ALTER TABLE fiat ADD COLUMN if not exists source text not null default 'cbr';
+ALTER TABLE fiat ADD COLUMN if not exists base text not null default 'RUB';
+
+CREATE TABLE if not exists assets
+(
+    id     bigserial primary key,
+    symbol text      not null unique
+);
+
+-- the bitcoin table becomes quotes of the BTC-USDT asset
+DO $$
+BEGIN
+    IF to_regclass('bitcoin') IS NOT NULL AND to_regclass('quotes') IS NULL THEN
+        INSERT INTO assets (symbol) VALUES ('BTC-USDT') ON CONFLICT (symbol) DO NOTHING;
+        ALTER TABLE bitcoin RENAME TO quotes;
+        ALTER TABLE quotes ADD COLUMN asset_id bigint references assets (id);
+        UPDATE quotes SET asset_id = (SELECT id FROM assets WHERE symbol = 'BTC-USDT');
+        ALTER TABLE quotes ALTER COLUMN asset_id SET NOT NULL;
+        ALTER TABLE quotes RENAME COLUMN btc_to_fiat TO to_fiat;
+        ALTER TABLE quotes ALTER COLUMN in_usdt TYPE decimal(20, 8);
+        ALTER TABLE quotes ALTER COLUMN in_rub TYPE decimal(24, 8);
+        IF to_regclass('bitcoin_quotes') IS NOT NULL THEN
+            ALTER TABLE bitcoin_quotes RENAME TO source_quotes;
+            ALTER TABLE source_quotes RENAME COLUMN bitcoin_id TO quote_id;
+            ALTER TABLE source_quotes ALTER COLUMN price TYPE decimal(20, 8);
+        END IF;
+    END IF;
+END $$;
+
+CREATE TABLE if not exists quotes
+(
+    id         bigserial                primary key,
+    asset_id   bigint                   not null references assets (id),
+    created_at timestamp with time zone not null,
+    in_usdt    decimal(20, 8)           not null,
+    in_rub     decimal(24, 8)           not null,
+    latest     boolean                  not null,
+    to_fiat    jsonb
+);
+
+CREATE TABLE if not exists source_quotes
+(
+    id         bigserial                primary key,
+    quote_id   bigint                   not null references quotes (id) on delete cascade,
+    source     text                     not null,
+    price      decimal(20, 8)           not null,
+    accepted   boolean                  not null,
+    created_at timestamp with time zone not null
+);
+
+CREATE INDEX if not exists quotes_asset_id_created_at_idx ON quotes (asset_id, created_at);
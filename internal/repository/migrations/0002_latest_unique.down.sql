@@ -0,0 +1,2 @@
+DROP INDEX if exists fiat_latest_idx;
+DROP INDEX if exists quotes_latest_idx;
@@ -0,0 +1,22 @@
+-- a crash between the two statements that moved the latest flag could leave
+-- zero or several latest records, the newest one of every asset/source is kept
+UPDATE quotes q SET latest = false
+WHERE q.latest AND EXISTS (
+    SELECT 1 FROM quotes o
+    WHERE o.asset_id = q.asset_id AND o.latest AND (o.created_at, o.id) > (q.created_at, q.id)
+);
+UPDATE quotes SET latest = true
+WHERE id IN (SELECT DISTINCT ON (asset_id) id FROM quotes ORDER BY asset_id, created_at DESC, id DESC)
+    AND asset_id NOT IN (SELECT asset_id FROM quotes WHERE latest);
+
+UPDATE fiat f SET latest = false
+WHERE f.latest AND EXISTS (
+    SELECT 1 FROM fiat o
+    WHERE o.source = f.source AND o.latest AND (o.created_at, o.id) > (f.created_at, f.id)
+);
+UPDATE fiat SET latest = true
+WHERE id IN (SELECT DISTINCT ON (source) id FROM fiat ORDER BY source, created_at DESC, id DESC)
+    AND source NOT IN (SELECT source FROM fiat WHERE latest);
+
+CREATE UNIQUE INDEX quotes_latest_idx ON quotes (asset_id) WHERE latest;
+CREATE UNIQUE INDEX fiat_latest_idx ON fiat (source) WHERE latest;
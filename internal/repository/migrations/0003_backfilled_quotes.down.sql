@@ -0,0 +1,4 @@
+DELETE FROM quotes WHERE backfilled;
+DROP INDEX if exists quotes_backfilled_idx;
+ALTER TABLE quotes DROP COLUMN interval;
+ALTER TABLE quotes DROP COLUMN backfilled;
@@ -0,0 +1,6 @@
+-- quotes built from exchange klines instead of live ticks, interval is the kline size like 1m
+ALTER TABLE quotes ADD COLUMN backfilled boolean not null default false;
+ALTER TABLE quotes ADD COLUMN interval text;
+
+-- running a backfill twice does not duplicate the records
+CREATE UNIQUE INDEX quotes_backfilled_idx ON quotes (asset_id, created_at) WHERE backfilled;
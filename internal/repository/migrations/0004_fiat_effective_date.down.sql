@@ -0,0 +1,2 @@
+ALTER TABLE fiat DROP CONSTRAINT IF EXISTS fiat_source_effective_date_key;
+ALTER TABLE fiat DROP COLUMN IF EXISTS effective_date;
@@ -0,0 +1,18 @@
+-- rates are keyed by the date the source set them for, not by the time they were fetched
+ALTER TABLE fiat ADD COLUMN effective_date date;
+
+-- backfilled rows are stamped with their effective date at UTC midnight,
+-- the date of fetched rows is the best guess that is left for them
+UPDATE fiat SET effective_date = CASE
+    WHEN NOT latest AND created_at = date_trunc('day', created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+        THEN (created_at AT TIME ZONE 'UTC')::date
+    ELSE (created_at AT TIME ZONE 'Europe/Moscow')::date
+END;
+
+-- one row of a source and date is kept, the latest one or else the newest
+DELETE FROM fiat f USING fiat o
+WHERE o.source = f.source AND o.effective_date = f.effective_date
+    AND (o.latest, o.created_at, o.id) > (f.latest, f.created_at, f.id);
+
+ALTER TABLE fiat ALTER COLUMN effective_date SET NOT NULL;
+ALTER TABLE fiat ADD CONSTRAINT fiat_source_effective_date_key UNIQUE (source, effective_date);
@@ -0,0 +1 @@
+ALTER TABLE fiat ALTER COLUMN usd_rub TYPE decimal(8, 4);
@@ -0,0 +1,2 @@
+-- usd_rub of sources with another base is the inverted rate, it is stored as computed
+ALTER TABLE fiat ALTER COLUMN usd_rub TYPE numeric;
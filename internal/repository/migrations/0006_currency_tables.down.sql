@@ -0,0 +1,11 @@
+ALTER TABLE fiat ADD COLUMN currencies jsonb;
+
+UPDATE fiat f SET currencies = coalesce((
+    SELECT jsonb_agg(jsonb_build_object('id', r.external_id, 'nominal', r.nominal, 'name', c.name,
+        'value', r.value, 'char_code', c.char_code, 'num_code', c.num_code) ORDER BY c.char_code)
+    FROM fiat_rates r JOIN currencies c ON c.id = r.currency_id
+    WHERE r.snapshot_id = f.id), '[]');
+
+ALTER TABLE fiat ALTER COLUMN currencies SET NOT NULL;
+DROP TABLE fiat_rates;
+DROP TABLE currencies;
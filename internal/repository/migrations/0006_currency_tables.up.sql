@@ -0,0 +1,39 @@
+-- the currencies of a fiat snapshot move from the jsonb array to rows of fiat_rates,
+-- currencies keeps every char code once
+CREATE TABLE currencies
+(
+    id        bigserial primary key,
+    char_code text      not null unique,
+    num_code  text      not null default '',
+    name      text      not null default ''
+);
+
+-- external_id is the id of the currency at the source, like R01235 of CBR
+CREATE TABLE fiat_rates
+(
+    snapshot_id bigint  not null references fiat (id) on delete cascade,
+    currency_id bigint  not null references currencies (id),
+    external_id text    not null default '',
+    nominal     integer not null,
+    value       numeric not null,
+    primary key (snapshot_id, currency_id)
+);
+
+-- the rates of a currency over time
+CREATE INDEX fiat_rates_currency_id_idx ON fiat_rates (currency_id, snapshot_id);
+
+-- sources without a num code only name a currency by its char code, the newest CBR names are kept
+INSERT INTO currencies (char_code, num_code, name)
+SELECT DISTINCT ON (c ->> 'char_code') c ->> 'char_code', coalesce(c ->> 'num_code', ''), coalesce(c ->> 'name', '')
+FROM fiat f CROSS JOIN jsonb_array_elements(f.currencies) c
+WHERE coalesce(c ->> 'char_code', '') <> ''
+ORDER BY c ->> 'char_code', coalesce(c ->> 'num_code', '') <> '' DESC, f.effective_date DESC;
+
+INSERT INTO fiat_rates (snapshot_id, currency_id, external_id, nominal, value)
+SELECT DISTINCT ON (f.id, cu.id) f.id, cu.id, coalesce(c ->> 'id', ''), (c ->> 'nominal')::integer, (c ->> 'value')::numeric
+FROM fiat f
+    CROSS JOIN jsonb_array_elements(f.currencies) c
+    JOIN currencies cu ON cu.char_code = c ->> 'char_code'
+ORDER BY f.id, cu.id;
+
+ALTER TABLE fiat DROP COLUMN currencies;
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"XTechProject/pkg/migrate"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := migrate.Load(Migrations())
+	require.NoError(t, err)
+	for i, m := range migrations {
+		require.Equal(t, i+1, m.Version, "migration versions have no gaps")
+		require.NotEmpty(t, m.Down, "migration %04d_%s can be rolled back", m.Version, m.Name)
+	}
+}
@@ -6,10 +6,12 @@ package mock_repository
 
 import (
 	models "XTechProject/internal/models"
+	context "context"
 	reflect "reflect"
 	time "time"
 
 	gomock "github.com/golang/mock/gomock"
+	decimal "github.com/shopspring/decimal"
 )
 
 // MockRepositorier is a mock of Repositorier interface.
@@ -35,147 +37,359 @@ func (m *MockRepositorier) EXPECT() *MockRepositorierMockRecorder {
 	return m.recorder
 }
 
-// CreateBTCRecord mocks base method.
-func (m *MockRepositorier) CreateBTCRecord(model *models.BTC) error {
+// CountBTC mocks base method.
+func (m *MockRepositorier) CountBTC(ctx context.Context, symbol string, filter models.HistoryFilter) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateBTCRecord", model)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "CountBTC", ctx, symbol, filter)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountBTC indicates an expected call of CountBTC.
+func (mr *MockRepositorierMockRecorder) CountBTC(ctx, symbol, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountBTC", reflect.TypeOf((*MockRepositorier)(nil).CountBTC), ctx, symbol, filter)
+}
+
+// CountCurrencyHistory mocks base method.
+func (m *MockRepositorier) CountCurrencyHistory(ctx context.Context, source string, filter models.CurrencyHistoryFilter) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountCurrencyHistory", ctx, source, filter)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountCurrencyHistory indicates an expected call of CountCurrencyHistory.
+func (mr *MockRepositorierMockRecorder) CountCurrencyHistory(ctx, source, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountCurrencyHistory", reflect.TypeOf((*MockRepositorier)(nil).CountCurrencyHistory), ctx, source, filter)
+}
+
+// CountFiat mocks base method.
+func (m *MockRepositorier) CountFiat(ctx context.Context, source string, filter models.HistoryFilter) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountFiat", ctx, source, filter)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountFiat indicates an expected call of CountFiat.
+func (mr *MockRepositorierMockRecorder) CountFiat(ctx, source, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountFiat", reflect.TypeOf((*MockRepositorier)(nil).CountFiat), ctx, source, filter)
+}
+
+// CreateBackfilledBTCRecords mocks base method.
+func (m *MockRepositorier) CreateBackfilledBTCRecords(ctx context.Context, records []models.BTC, step time.Duration) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateBackfilledBTCRecords", ctx, records, step)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateBackfilledBTCRecords indicates an expected call of CreateBackfilledBTCRecords.
+func (mr *MockRepositorierMockRecorder) CreateBackfilledBTCRecords(ctx, records, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBackfilledBTCRecords", reflect.TypeOf((*MockRepositorier)(nil).CreateBackfilledBTCRecords), ctx, records, step)
+}
+
+// CreateFiatHistoryRecord mocks base method.
+func (m *MockRepositorier) CreateFiatHistoryRecord(ctx context.Context, model *models.Fiat) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateFiatHistoryRecord", ctx, model)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// CreateBTCRecord indicates an expected call of CreateBTCRecord.
-func (mr *MockRepositorierMockRecorder) CreateBTCRecord(model interface{}) *gomock.Call {
+// CreateFiatHistoryRecord indicates an expected call of CreateFiatHistoryRecord.
+func (mr *MockRepositorierMockRecorder) CreateFiatHistoryRecord(ctx, model interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBTCRecord", reflect.TypeOf((*MockRepositorier)(nil).CreateBTCRecord), model)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateFiatHistoryRecord", reflect.TypeOf((*MockRepositorier)(nil).CreateFiatHistoryRecord), ctx, model)
 }
 
-// CreateFiatRecord mocks base method.
-func (m *MockRepositorier) CreateFiatRecord(model *models.Fiat) error {
+// CreateLatestBTCRecord mocks base method.
+func (m *MockRepositorier) CreateLatestBTCRecord(ctx context.Context, model *models.BTC) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateFiatRecord", model)
+	ret := m.ctrl.Call(m, "CreateLatestBTCRecord", ctx, model)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// CreateFiatRecord indicates an expected call of CreateFiatRecord.
-func (mr *MockRepositorierMockRecorder) CreateFiatRecord(model interface{}) *gomock.Call {
+// CreateLatestBTCRecord indicates an expected call of CreateLatestBTCRecord.
+func (mr *MockRepositorierMockRecorder) CreateLatestBTCRecord(ctx, model interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLatestBTCRecord", reflect.TypeOf((*MockRepositorier)(nil).CreateLatestBTCRecord), ctx, model)
+}
+
+// CreateLatestFiatRecord mocks base method.
+func (m *MockRepositorier) CreateLatestFiatRecord(ctx context.Context, model *models.Fiat) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateLatestFiatRecord", ctx, model)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateLatestFiatRecord indicates an expected call of CreateLatestFiatRecord.
+func (mr *MockRepositorierMockRecorder) CreateLatestFiatRecord(ctx, model interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateFiatRecord", reflect.TypeOf((*MockRepositorier)(nil).CreateFiatRecord), model)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLatestFiatRecord", reflect.TypeOf((*MockRepositorier)(nil).CreateLatestFiatRecord), ctx, model)
 }
 
 // GetAllBTC mocks base method.
-func (m *MockRepositorier) GetAllBTC(limit, offset int, orderBy string) ([]models.BTC, error) {
+func (m *MockRepositorier) GetAllBTC(ctx context.Context, symbol string, filter models.HistoryFilter) ([]models.BTC, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllBTC", limit, offset, orderBy)
+	ret := m.ctrl.Call(m, "GetAllBTC", ctx, symbol, filter)
 	ret0, _ := ret[0].([]models.BTC)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAllBTC indicates an expected call of GetAllBTC.
-func (mr *MockRepositorierMockRecorder) GetAllBTC(limit, offset, orderBy interface{}) *gomock.Call {
+func (mr *MockRepositorierMockRecorder) GetAllBTC(ctx, symbol, filter interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllBTC", reflect.TypeOf((*MockRepositorier)(nil).GetAllBTC), limit, offset, orderBy)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllBTC", reflect.TypeOf((*MockRepositorier)(nil).GetAllBTC), ctx, symbol, filter)
 }
 
 // GetAllFiat mocks base method.
-func (m *MockRepositorier) GetAllFiat(limit, offset int, orderBy string) ([]models.Fiat, error) {
+func (m *MockRepositorier) GetAllFiat(ctx context.Context, source string, filter models.HistoryFilter) ([]models.Fiat, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllFiat", limit, offset, orderBy)
+	ret := m.ctrl.Call(m, "GetAllFiat", ctx, source, filter)
 	ret0, _ := ret[0].([]models.Fiat)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAllFiat indicates an expected call of GetAllFiat.
-func (mr *MockRepositorierMockRecorder) GetAllFiat(limit, offset, orderBy interface{}) *gomock.Call {
+func (mr *MockRepositorierMockRecorder) GetAllFiat(ctx, source, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllFiat", reflect.TypeOf((*MockRepositorier)(nil).GetAllFiat), ctx, source, filter)
+}
+
+// GetBTCAsOf mocks base method.
+func (m *MockRepositorier) GetBTCAsOf(ctx context.Context, symbol string, t time.Time) (*models.BTC, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBTCAsOf", ctx, symbol, t)
+	ret0, _ := ret[0].(*models.BTC)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBTCAsOf indicates an expected call of GetBTCAsOf.
+func (mr *MockRepositorierMockRecorder) GetBTCAsOf(ctx, symbol, t interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBTCAsOf", reflect.TypeOf((*MockRepositorier)(nil).GetBTCAsOf), ctx, symbol, t)
+}
+
+// GetBTCQuotes mocks base method.
+func (m *MockRepositorier) GetBTCQuotes(ctx context.Context, btcID int) ([]models.SourceQuote, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBTCQuotes", ctx, btcID)
+	ret0, _ := ret[0].([]models.SourceQuote)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBTCQuotes indicates an expected call of GetBTCQuotes.
+func (mr *MockRepositorierMockRecorder) GetBTCQuotes(ctx, btcID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllFiat", reflect.TypeOf((*MockRepositorier)(nil).GetAllFiat), limit, offset, orderBy)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBTCQuotes", reflect.TypeOf((*MockRepositorier)(nil).GetBTCQuotes), ctx, btcID)
+}
+
+// GetBTCStats mocks base method.
+func (m *MockRepositorier) GetBTCStats(ctx context.Context, symbol string, from, to time.Time) (*models.Stats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBTCStats", ctx, symbol, from, to)
+	ret0, _ := ret[0].(*models.Stats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBTCStats indicates an expected call of GetBTCStats.
+func (mr *MockRepositorierMockRecorder) GetBTCStats(ctx, symbol, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBTCStats", reflect.TypeOf((*MockRepositorier)(nil).GetBTCStats), ctx, symbol, from, to)
+}
+
+// GetCandles mocks base method.
+func (m *MockRepositorier) GetCandles(ctx context.Context, symbol, interval string, from, to *time.Time) ([]models.Candle, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCandles", ctx, symbol, interval, from, to)
+	ret0, _ := ret[0].([]models.Candle)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCandles indicates an expected call of GetCandles.
+func (mr *MockRepositorierMockRecorder) GetCandles(ctx, symbol, interval, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCandles", reflect.TypeOf((*MockRepositorier)(nil).GetCandles), ctx, symbol, interval, from, to)
+}
+
+// GetCurrencyHistory mocks base method.
+func (m *MockRepositorier) GetCurrencyHistory(ctx context.Context, source string, filter models.CurrencyHistoryFilter) ([]models.CurrencyPoint, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCurrencyHistory", ctx, source, filter)
+	ret0, _ := ret[0].([]models.CurrencyPoint)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCurrencyHistory indicates an expected call of GetCurrencyHistory.
+func (mr *MockRepositorierMockRecorder) GetCurrencyHistory(ctx, source, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCurrencyHistory", reflect.TypeOf((*MockRepositorier)(nil).GetCurrencyHistory), ctx, source, filter)
+}
+
+// GetCurrencyStats mocks base method.
+func (m *MockRepositorier) GetCurrencyStats(ctx context.Context, source, charCode string, from, to time.Time) (*models.Stats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCurrencyStats", ctx, source, charCode, from, to)
+	ret0, _ := ret[0].(*models.Stats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCurrencyStats indicates an expected call of GetCurrencyStats.
+func (mr *MockRepositorierMockRecorder) GetCurrencyStats(ctx, source, charCode, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCurrencyStats", reflect.TypeOf((*MockRepositorier)(nil).GetCurrencyStats), ctx, source, charCode, from, to)
+}
+
+// GetFiatAsOf mocks base method.
+func (m *MockRepositorier) GetFiatAsOf(ctx context.Context, source string, date time.Time) (*models.Fiat, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFiatAsOf", ctx, source, date)
+	ret0, _ := ret[0].(*models.Fiat)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFiatAsOf indicates an expected call of GetFiatAsOf.
+func (mr *MockRepositorierMockRecorder) GetFiatAsOf(ctx, source, date interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFiatAsOf", reflect.TypeOf((*MockRepositorier)(nil).GetFiatAsOf), ctx, source, date)
+}
+
+// GetFiatDates mocks base method.
+func (m *MockRepositorier) GetFiatDates(ctx context.Context, source string, from, to time.Time) ([]time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFiatDates", ctx, source, from, to)
+	ret0, _ := ret[0].([]time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFiatDates indicates an expected call of GetFiatDates.
+func (mr *MockRepositorierMockRecorder) GetFiatDates(ctx, source, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFiatDates", reflect.TypeOf((*MockRepositorier)(nil).GetFiatDates), ctx, source, from, to)
 }
 
 // GetLastBTC mocks base method.
-func (m *MockRepositorier) GetLastBTC() (*models.BTC, error) {
+func (m *MockRepositorier) GetLastBTC(ctx context.Context, symbol string) (*models.BTC, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetLastBTC")
+	ret := m.ctrl.Call(m, "GetLastBTC", ctx, symbol)
 	ret0, _ := ret[0].(*models.BTC)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetLastBTC indicates an expected call of GetLastBTC.
-func (mr *MockRepositorierMockRecorder) GetLastBTC() *gomock.Call {
+func (mr *MockRepositorierMockRecorder) GetLastBTC(ctx, symbol interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastBTC", reflect.TypeOf((*MockRepositorier)(nil).GetLastBTC))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastBTC", reflect.TypeOf((*MockRepositorier)(nil).GetLastBTC), ctx, symbol)
 }
 
-// GetLastDateForFiat mocks base method.
-func (m *MockRepositorier) GetLastDateForFiat() (*time.Time, error) {
+// GetLastBTCFiat mocks base method.
+func (m *MockRepositorier) GetLastBTCFiat(ctx context.Context, symbol string, codes []string) (*models.BTC, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetLastDateForFiat")
-	ret0, _ := ret[0].(*time.Time)
+	ret := m.ctrl.Call(m, "GetLastBTCFiat", ctx, symbol, codes)
+	ret0, _ := ret[0].(*models.BTC)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetLastDateForFiat indicates an expected call of GetLastDateForFiat.
-func (mr *MockRepositorierMockRecorder) GetLastDateForFiat() *gomock.Call {
+// GetLastBTCFiat indicates an expected call of GetLastBTCFiat.
+func (mr *MockRepositorierMockRecorder) GetLastBTCFiat(ctx, symbol, codes interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastDateForFiat", reflect.TypeOf((*MockRepositorier)(nil).GetLastDateForFiat))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastBTCFiat", reflect.TypeOf((*MockRepositorier)(nil).GetLastBTCFiat), ctx, symbol, codes)
 }
 
 // GetLastFiat mocks base method.
-func (m *MockRepositorier) GetLastFiat() (*models.Fiat, error) {
+func (m *MockRepositorier) GetLastFiat(ctx context.Context, source string, codes []string) (*models.Fiat, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetLastFiat")
+	ret := m.ctrl.Call(m, "GetLastFiat", ctx, source, codes)
 	ret0, _ := ret[0].(*models.Fiat)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetLastFiat indicates an expected call of GetLastFiat.
-func (mr *MockRepositorierMockRecorder) GetLastFiat() *gomock.Call {
+func (mr *MockRepositorierMockRecorder) GetLastFiat(ctx, source, codes interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastFiat", reflect.TypeOf((*MockRepositorier)(nil).GetLastFiat))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastFiat", reflect.TypeOf((*MockRepositorier)(nil).GetLastFiat), ctx, source, codes)
 }
 
-// SetAllRecordsFiatLatestFalse mocks base method.
-func (m *MockRepositorier) SetAllRecordsFiatLatestFalse() error {
+// GetPeakClose mocks base method.
+func (m *MockRepositorier) GetPeakClose(ctx context.Context, symbol, interval string, before time.Time) (decimal.NullDecimal, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetAllRecordsFiatLatestFalse")
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "GetPeakClose", ctx, symbol, interval, before)
+	ret0, _ := ret[0].(decimal.NullDecimal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// SetAllRecordsFiatLatestFalse indicates an expected call of SetAllRecordsFiatLatestFalse.
-func (mr *MockRepositorierMockRecorder) SetAllRecordsFiatLatestFalse() *gomock.Call {
+// GetPeakClose indicates an expected call of GetPeakClose.
+func (mr *MockRepositorierMockRecorder) GetPeakClose(ctx, symbol, interval, before interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAllRecordsFiatLatestFalse", reflect.TypeOf((*MockRepositorier)(nil).SetAllRecordsFiatLatestFalse))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPeakClose", reflect.TypeOf((*MockRepositorier)(nil).GetPeakClose), ctx, symbol, interval, before)
 }
 
-// UpdateFiatForLastBTC mocks base method.
-func (m *MockRepositorier) UpdateFiatForLastBTC(model *models.BTC) error {
+// UnknownCurrencies mocks base method.
+func (m *MockRepositorier) UnknownCurrencies(ctx context.Context, codes []string) ([]string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateFiatForLastBTC", model)
+	ret := m.ctrl.Call(m, "UnknownCurrencies", ctx, codes)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UnknownCurrencies indicates an expected call of UnknownCurrencies.
+func (mr *MockRepositorierMockRecorder) UnknownCurrencies(ctx, codes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnknownCurrencies", reflect.TypeOf((*MockRepositorier)(nil).UnknownCurrencies), ctx, codes)
+}
+
+// UpdateFiatForBTCRecords mocks base method.
+func (m *MockRepositorier) UpdateFiatForBTCRecords(ctx context.Context, records []models.BTC) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateFiatForBTCRecords", ctx, records)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// UpdateFiatForLastBTC indicates an expected call of UpdateFiatForLastBTC.
-func (mr *MockRepositorierMockRecorder) UpdateFiatForLastBTC(model interface{}) *gomock.Call {
+// UpdateFiatForBTCRecords indicates an expected call of UpdateFiatForBTCRecords.
+func (mr *MockRepositorierMockRecorder) UpdateFiatForBTCRecords(ctx, records interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateFiatForLastBTC", reflect.TypeOf((*MockRepositorier)(nil).UpdateFiatForLastBTC), model)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateFiatForBTCRecords", reflect.TypeOf((*MockRepositorier)(nil).UpdateFiatForBTCRecords), ctx, records)
 }
 
-// UpdateLastRecordForBTC mocks base method.
-func (m *MockRepositorier) UpdateLastRecordForBTC() error {
+// UpdateFiatForLastBTC mocks base method.
+func (m *MockRepositorier) UpdateFiatForLastBTC(ctx context.Context, model *models.BTC) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateLastRecordForBTC")
+	ret := m.ctrl.Call(m, "UpdateFiatForLastBTC", ctx, model)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// UpdateLastRecordForBTC indicates an expected call of UpdateLastRecordForBTC.
-func (mr *MockRepositorierMockRecorder) UpdateLastRecordForBTC() *gomock.Call {
+// UpdateFiatForLastBTC indicates an expected call of UpdateFiatForLastBTC.
+func (mr *MockRepositorierMockRecorder) UpdateFiatForLastBTC(ctx, model interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateLastRecordForBTC", reflect.TypeOf((*MockRepositorier)(nil).UpdateLastRecordForBTC))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateFiatForLastBTC", reflect.TypeOf((*MockRepositorier)(nil).UpdateFiatForLastBTC), ctx, model)
 }
@@ -3,9 +3,13 @@ package repository
 import (
 	"XTechProject/internal/models"
 	"XTechProject/pkg/postgres"
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/jackc/pgx/pgtype"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
 	"time"
 )
 
@@ -14,142 +18,572 @@ type Repository struct {
 }
 
 func New(driver *postgres.Postgres) *Repository {
-	r := &Repository{driver: driver}
-	r.CreateTablesIfTheyNotExist()
-	return r
+	return &Repository{driver: driver}
 }
 
 type Repositorier interface {
-	CreateBTCRecord(model *models.BTC) error
-	UpdateLastRecordForBTC() error
-	GetLastBTC() (*models.BTC, error)
-	GetAllBTC(limit, offset int, orderBy string) ([]models.BTC, error)
-	UpdateFiatForLastBTC(model *models.BTC) error
-
-	GetLastFiat() (*models.Fiat, error)
-	GetAllFiat(limit, offset int, orderBy string) ([]models.Fiat, error)
-	CreateFiatRecord(model *models.Fiat) error
-	SetAllRecordsFiatLatestFalse() error
-	GetLastDateForFiat() (*time.Time, error)
-}
-
-func (r *Repository) CreateTablesIfTheyNotExist() {
-	r.driver.DB.Exec(`CREATE TABLE if not exists fiat
-	(
-		id         bigserial              	primary key,
-		currencies jsonb                    not null,
-		usd_rub    decimal(8, 4)            not null,
-		created_at timestamp with time zone not null,
-		latest     boolean                  not null
-	);`)
-	r.driver.DB.Exec(`CREATE TABLE if not exists bitcoin
-	(
-		id                bigserial                primary key,
-		created_at 		  timestamp with time zone not null,
-		in_usdt           decimal(10, 1)           not null,
-		in_rub            decimal(12, 5)           not null,
-		latest            boolean                  not null,
-		btc_to_fiat       jsonb                    
-	);`)
-}
-
-func (r *Repository) CreateBTCRecord(model *models.BTC) error {
-	query := `
-	INSERT INTO bitcoin (in_usdt, created_at, latest, in_rub, btc_to_fiat) 
-	VALUES (:in_usdt, :created_at, :latest, :in_rub, :btc_to_fiat)`
-	_, err := r.driver.DB.NamedExec(query, model)
-	return err
+	CreateLatestBTCRecord(ctx context.Context, model *models.BTC) error
+	CreateBackfilledBTCRecords(ctx context.Context, records []models.BTC, step time.Duration) (int, error)
+	GetLastBTC(ctx context.Context, symbol string) (*models.BTC, error)
+	GetLastBTCFiat(ctx context.Context, symbol string, codes []string) (*models.BTC, error)
+	GetBTCAsOf(ctx context.Context, symbol string, t time.Time) (*models.BTC, error)
+	GetAllBTC(ctx context.Context, symbol string, filter models.HistoryFilter) ([]models.BTC, error)
+	CountBTC(ctx context.Context, symbol string, filter models.HistoryFilter) (int, error)
+	GetBTCQuotes(ctx context.Context, btcID int) ([]models.SourceQuote, error)
+	GetCandles(ctx context.Context, symbol, interval string, from, to *time.Time) ([]models.Candle, error)
+	GetPeakClose(ctx context.Context, symbol, interval string, before time.Time) (decimal.NullDecimal, error)
+	GetBTCStats(ctx context.Context, symbol string, from, to time.Time) (*models.Stats, error)
+	UpdateFiatForLastBTC(ctx context.Context, model *models.BTC) error
+	UpdateFiatForBTCRecords(ctx context.Context, records []models.BTC) error
+
+	GetLastFiat(ctx context.Context, source string, codes []string) (*models.Fiat, error)
+	GetAllFiat(ctx context.Context, source string, filter models.HistoryFilter) ([]models.Fiat, error)
+	CountFiat(ctx context.Context, source string, filter models.HistoryFilter) (int, error)
+	CreateLatestFiatRecord(ctx context.Context, model *models.Fiat) (bool, error)
+	CreateFiatHistoryRecord(ctx context.Context, model *models.Fiat) (bool, error)
+	GetFiatAsOf(ctx context.Context, source string, date time.Time) (*models.Fiat, error)
+	GetFiatDates(ctx context.Context, source string, from, to time.Time) ([]time.Time, error)
+	UnknownCurrencies(ctx context.Context, codes []string) ([]string, error)
+	GetCurrencyHistory(ctx context.Context, source string, filter models.CurrencyHistoryFilter) ([]models.CurrencyPoint, error)
+	CountCurrencyHistory(ctx context.Context, source string, filter models.CurrencyHistoryFilter) (int, error)
+	GetCurrencyStats(ctx context.Context, source, charCode string, from, to time.Time) (*models.Stats, error)
 }
 
-func (r *Repository) UpdateFiatForLastBTC(model *models.BTC) error {
-	query := `UPDATE bitcoin SET in_rub=:in_rub, btc_to_fiat=:btc_to_fiat WHERE latest = true`
-	_, err := r.driver.DB.NamedExec(query, model)
-	return err
+// quoteColumns are the columns of models.BTC without to_fiat
+const quoteColumns = `q.id, a.symbol, q.in_usdt, q.in_rub, q.latest, q.created_at,
+		q.backfilled, coalesce(q.interval, '') AS interval`
+
+// selectQuotes selects models.BTC, the assets are joined for their symbol
+const selectQuotes = `
+	SELECT ` + quoteColumns + `, q.to_fiat
+	FROM quotes q JOIN assets a ON a.id = q.asset_id`
+
+// fiatColumns are the columns of models.Fiat without the currencies
+const fiatColumns = `f.id, f.source, f.base, f.latest, f.created_at, f.effective_date, f.usd_rub`
+
+// selectFiat selects models.Fiat, the rates of a snapshot are aggregated into the currencies array.
+// codesParam is the text[] parameter of the char codes to keep, all currencies are kept when it is NULL.
+func selectFiat(codesParam string) string {
+	return `
+	SELECT ` + fiatColumns + `,
+		coalesce((SELECT json_agg(json_build_object('id', r.external_id, 'nominal', r.nominal, 'name', c.name,
+			'value', r.value, 'char_code', c.char_code, 'num_code', c.num_code) ORDER BY c.char_code)
+		FROM fiat_rates r JOIN currencies c ON c.id = r.currency_id
+		WHERE r.snapshot_id = f.id AND (` + codesParam + `::text[] IS NULL OR c.char_code = ANY(` + codesParam + `))), '[]') AS currencies
+	FROM fiat f`
 }
 
-func (r *Repository) UpdateLastRecordForBTC() error {
-	query := `UPDATE bitcoin SET latest = false WHERE latest = true`
-	_, err := r.driver.DB.Exec(query)
-	return err
+// textArray passes values as a text[] parameter, nil values are NULL
+func textArray(values []string) interface{} {
+	arr := &pgtype.TextArray{}
+	_ = arr.Set(values)
+	return arr
 }
 
-func (r *Repository) CreateFiatRecord(model *models.Fiat) error {
-	query := `
-	INSERT INTO fiat (currencies, latest, usd_rub, created_at)
-	VALUES ($1, $2, $3, CURRENT_TIMESTAMP)`
-	_, err := r.driver.DB.Exec(query, model.Currencies, model.Latest, model.USDRUB)
-	return err
+// CreateLatestBTCRecord inserts the record together with the exchange quotes it was built from
+// and makes it the only latest record of its symbol. Concurrent calls for a symbol wait for each other
+// on the asset row, the quotes_latest_idx index guards the single latest record.
+func (r *Repository) CreateLatestBTCRecord(ctx context.Context, model *models.BTC) error {
+	tx, err := r.driver.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// the asset is created with its first quote
+	query := `INSERT INTO assets (symbol) VALUES ($1) ON CONFLICT (symbol) DO NOTHING`
+	if _, err = tx.ExecContext(ctx, query, model.Symbol); err != nil {
+		return err
+	}
+	var assetID int
+	query = `SELECT id FROM assets WHERE symbol = $1 FOR UPDATE`
+	if err = tx.GetContext(ctx, &assetID, query, model.Symbol); err != nil {
+		return err
+	}
+	query = `UPDATE quotes SET latest = false WHERE latest = true AND asset_id = $1`
+	if _, err = tx.ExecContext(ctx, query, assetID); err != nil {
+		return err
+	}
+	model.Latest = true
+	query = `
+	INSERT INTO quotes (asset_id, in_usdt, created_at, latest, in_rub, to_fiat) 
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id`
+	err = tx.GetContext(ctx, &model.ID, query, assetID, model.InUSDT, model.CreatedAt, model.Latest, model.InRub, model.BTCToFiat)
+	if err != nil {
+		return err
+	}
+	for i := range model.Quotes {
+		model.Quotes[i].QuoteID = model.ID
+	}
+	if len(model.Quotes) != 0 {
+		query = `
+		INSERT INTO source_quotes (quote_id, source, price, accepted, created_at)
+		VALUES (:quote_id, :source, :price, :accepted, :created_at)`
+		if _, err = tx.NamedExecContext(ctx, query, model.Quotes); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CreateBackfilledBTCRecords inserts records that are never latest, they are stamped with the close time of their kline.
+// A record is skipped when there is any other record of its symbol after CreatedAt-step up to CreatedAt,
+// the span of its kline, so only gaps are filled.
+func (r *Repository) CreateBackfilledBTCRecords(ctx context.Context, records []models.BTC, step time.Duration) (int, error) {
+	if len(records) == 0 {
+		return 0, nil
+	}
+	tx, err := r.driver.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	query := `INSERT INTO assets (symbol) VALUES ($1) ON CONFLICT (symbol) DO NOTHING`
+	if _, err = tx.ExecContext(ctx, query, records[0].Symbol); err != nil {
+		return 0, err
+	}
+	stmt, err := tx.PreparexContext(ctx, `
+	INSERT INTO quotes (asset_id, in_usdt, in_rub, to_fiat, created_at, latest, backfilled, interval)
+	SELECT a.id, $2, $3, $7, $4, false, true, $5 FROM assets a
+	WHERE a.symbol = $1 AND NOT EXISTS (
+		SELECT 1 FROM quotes q WHERE q.asset_id = a.id AND q.created_at > $6 AND q.created_at <= $4
+	)
+	ON CONFLICT (asset_id, created_at) WHERE backfilled DO NOTHING`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	var created int
+	for _, m := range records {
+		res, err := stmt.ExecContext(ctx, m.Symbol, m.InUSDT, m.InRub, m.CreatedAt, m.Interval, m.CreatedAt.Add(-step), m.BTCToFiat)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		created += int(n)
+	}
+	return created, tx.Commit()
+}
+
+func (r *Repository) GetBTCQuotes(ctx context.Context, btcID int) ([]models.SourceQuote, error) {
+	quotes := []models.SourceQuote{}
+	query := `SELECT * FROM source_quotes WHERE quote_id = $1 ORDER BY source`
+	err := r.driver.DB.SelectContext(ctx, &quotes, query, btcID)
+	return quotes, err
 }
 
-func (r *Repository) SetAllRecordsFiatLatestFalse() error {
-	query := `UPDATE fiat SET latest = false  WHERE latest = true`
-	_, err := r.driver.DB.Exec(query)
+func (r *Repository) UpdateFiatForLastBTC(ctx context.Context, model *models.BTC) error {
+	query := `UPDATE quotes SET in_rub=:in_rub, to_fiat=:to_fiat WHERE id = :id`
+	_, err := r.driver.DB.NamedExecContext(ctx, query, model)
 	return err
 }
 
-func (r *Repository) GetLastDateForFiat() (*time.Time, error) {
-	var date time.Time
-	query := `SELECT created_at FROM fiat WHERE latest = true`
-	err := r.driver.DB.Get(&date, query)
+// UpdateFiatForBTCRecords updates the fiat prices of the records in one transaction
+func (r *Repository) UpdateFiatForBTCRecords(ctx context.Context, records []models.BTC) error {
+	if len(records) == 0 {
+		return nil
+	}
+	tx, err := r.driver.DB.BeginTxx(ctx, nil)
 	if err != nil {
-		// OK if there is no date
-		if errors.Is(sql.ErrNoRows, err) {
-			return nil, nil
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareNamedContext(ctx, `UPDATE quotes SET in_rub=:in_rub, to_fiat=:to_fiat WHERE id = :id`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, m := range records {
+		if _, err = stmt.ExecContext(ctx, m); err != nil {
+			return err
 		}
 	}
-	return &date, err
+	return tx.Commit()
+}
+
+// CreateLatestFiatRecord inserts the rates unless the source already has rates of their effective date,
+// false is returned for skipped rates. The latest record of a source is the one with the newest effective date,
+// so rates that come late never replace newer ones. Concurrent calls for a source wait for each other
+// on an advisory lock, the fiat_latest_idx index guards the single latest record.
+func (r *Repository) CreateLatestFiatRecord(ctx context.Context, model *models.Fiat) (bool, error) {
+	tx, err := r.driver.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if _, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('fiat'), hashtext($1))`, model.Source); err != nil {
+		return false, err
+	}
+	query := `
+	INSERT INTO fiat (source, base, latest, usd_rub, created_at, effective_date)
+	VALUES ($1, $2, false, $3, CURRENT_TIMESTAMP, $4)
+	ON CONFLICT (source, effective_date) DO NOTHING
+	RETURNING id, created_at`
+	err = tx.QueryRowxContext(ctx, query, model.Source, model.Base, model.USDRUB, model.EffectiveDate).
+		Scan(&model.ID, &model.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err = createFiatRates(ctx, tx, model); err != nil {
+		return false, err
+	}
+	query = `
+	UPDATE fiat SET latest = false
+	WHERE latest = true AND source = $1 AND effective_date < (SELECT max(effective_date) FROM fiat WHERE source = $1)`
+	if _, err = tx.ExecContext(ctx, query, model.Source); err != nil {
+		return false, err
+	}
+	query = `
+	UPDATE fiat SET latest = true
+	WHERE latest = false AND source = $1 AND effective_date = (SELECT max(effective_date) FROM fiat WHERE source = $1)`
+	if _, err = tx.ExecContext(ctx, query, model.Source); err != nil {
+		return false, err
+	}
+	if err = tx.GetContext(ctx, &model.Latest, `SELECT latest FROM fiat WHERE id = $1`, model.ID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
 }
 
-func (r *Repository) GetLastBTC() (*models.BTC, error) {
-	query := `SELECT * FROM bitcoin WHERE latest = true`
+// CreateFiatHistoryRecord inserts past rates stamped with model.CreatedAt, they never become latest.
+// False is returned when the source already has rates of their effective date.
+func (r *Repository) CreateFiatHistoryRecord(ctx context.Context, model *models.Fiat) (bool, error) {
+	tx, err := r.driver.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	query := `
+	INSERT INTO fiat (source, base, latest, usd_rub, created_at, effective_date)
+	VALUES ($1, $2, false, $3, $4, $5)
+	ON CONFLICT (source, effective_date) DO NOTHING
+	RETURNING id`
+	err = tx.GetContext(ctx, &model.ID, query, model.Source, model.Base, model.USDRUB, model.CreatedAt, model.EffectiveDate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err = createFiatRates(ctx, tx, model); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// createFiatRates stores model.Currencies as the rates of the snapshot model.ID.
+// Unknown char codes are added to currencies, a num code and name of a source that has them
+// replace the ones of sources that only know the char code.
+func createFiatRates(ctx context.Context, tx *sqlx.Tx, model *models.Fiat) error {
+	query := `
+	INSERT INTO currencies (char_code, num_code, name)
+	SELECT DISTINCT ON (c.char_code) c.char_code, coalesce(c.num_code, ''), coalesce(c.name, '')
+	FROM jsonb_to_recordset($1::jsonb) AS c(char_code text, num_code text, name text)
+	WHERE coalesce(c.char_code, '') <> ''
+	ORDER BY c.char_code
+	ON CONFLICT (char_code) DO UPDATE SET num_code = excluded.num_code, name = excluded.name
+	WHERE excluded.num_code <> '' AND (currencies.num_code, currencies.name) IS DISTINCT FROM (excluded.num_code, excluded.name)`
+	if _, err := tx.ExecContext(ctx, query, string(model.Currencies)); err != nil {
+		return err
+	}
+	query = `
+	INSERT INTO fiat_rates (snapshot_id, currency_id, external_id, nominal, value)
+	SELECT DISTINCT ON (cu.id) $1::bigint, cu.id, coalesce(c.id, ''), c.nominal, c.value
+	FROM jsonb_to_recordset($2::jsonb) AS c(id text, char_code text, nominal integer, value numeric)
+		JOIN currencies cu ON cu.char_code = c.char_code
+	ORDER BY cu.id`
+	_, err := tx.ExecContext(ctx, query, model.ID, string(model.Currencies))
+	return err
+}
+
+// GetFiatAsOf returns the rates that were in effect on date, the record with the newest effective date
+// not after it. sql.ErrNoRows is returned when the source has no rates that old.
+func (r *Repository) GetFiatAsOf(ctx context.Context, source string, date time.Time) (*models.Fiat, error) {
+	query := selectFiat("NULL") + `
+	WHERE f.source = $1 AND f.effective_date <= $2::date
+	ORDER BY f.effective_date DESC LIMIT 1`
+	var fiat models.Fiat
+	err := r.driver.DB.GetContext(ctx, &fiat, query, source, date.Format("2006-01-02"))
+	return &fiat, err
+}
+
+// GetFiatDates returns the effective dates from..to inclusive that have rates of the source
+func (r *Repository) GetFiatDates(ctx context.Context, source string, from, to time.Time) ([]time.Time, error) {
+	dates := []time.Time{}
+	query := `
+	SELECT effective_date FROM fiat
+	WHERE source = $1 AND effective_date BETWEEN $2::date AND $3::date
+	ORDER BY effective_date`
+	err := r.driver.DB.SelectContext(ctx, &dates, query, source, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	return dates, err
+}
+
+func (r *Repository) GetLastBTC(ctx context.Context, symbol string) (*models.BTC, error) {
+	query := selectQuotes + ` WHERE a.symbol = $1 AND q.latest = true`
+	var btc models.BTC
+	err := r.driver.DB.GetContext(ctx, &btc, query, symbol)
+	return &btc, err
+}
+
+// GetBTCAsOf returns the last record of the symbol created at or before t
+func (r *Repository) GetBTCAsOf(ctx context.Context, symbol string, t time.Time) (*models.BTC, error) {
+	query := selectQuotes + ` WHERE a.symbol = $1 AND q.created_at <= $2 ORDER BY q.created_at DESC, q.id DESC LIMIT 1`
 	var btc models.BTC
-	err := r.driver.DB.Get(&btc, query)
+	err := r.driver.DB.GetContext(ctx, &btc, query, symbol, t)
 	return &btc, err
 }
 
-func (r *Repository) GetLastFiat() (*models.Fiat, error) {
-	query := `SELECT * FROM fiat WHERE latest = true`
+// GetLastFiat returns the latest rates of the source with the currencies of codes, all of them for nil codes
+func (r *Repository) GetLastFiat(ctx context.Context, source string, codes []string) (*models.Fiat, error) {
+	query := selectFiat("$2") + ` WHERE f.latest = true AND f.source = $1`
 	var fiat models.Fiat
-	err := r.driver.DB.Get(&fiat, query)
+	err := r.driver.DB.GetContext(ctx, &fiat, query, source, textArray(codes))
 	return &fiat, err
 }
 
-func (r *Repository) GetAllBTC(limit, offset int, orderBy string) ([]models.BTC, error) {
+// GetLastBTCFiat returns the latest record of the symbol, its prices in fiat are limited to codes unless they are nil
+func (r *Repository) GetLastBTCFiat(ctx context.Context, symbol string, codes []string) (*models.BTC, error) {
+	query := `
+	SELECT ` + quoteColumns + `,
+		CASE WHEN $2::text[] IS NULL THEN q.to_fiat
+			ELSE (SELECT coalesce(jsonb_object_agg(key, value), '{}') FROM jsonb_each(q.to_fiat) WHERE key = ANY($2))
+		END AS to_fiat
+	FROM quotes q JOIN assets a ON a.id = q.asset_id
+	WHERE a.symbol = $1 AND q.latest = true`
+	var btc models.BTC
+	err := r.driver.DB.GetContext(ctx, &btc, query, symbol, textArray(codes))
+	return &btc, err
+}
+
+// UnknownCurrencies returns the codes that are neither stored currencies nor bases of fiat sources
+func (r *Repository) UnknownCurrencies(ctx context.Context, codes []string) ([]string, error) {
+	unknown := []string{}
+	query := `
+	SELECT code FROM unnest($1::text[]) AS code
+	WHERE NOT EXISTS (SELECT 1 FROM currencies c WHERE c.char_code = code)
+		AND NOT EXISTS (SELECT 1 FROM fiat f WHERE f.base = code)
+	ORDER BY code`
+	err := r.driver.DB.SelectContext(ctx, &unknown, query, textArray(codes))
+	return unknown, err
+}
+
+func (r *Repository) GetAllBTC(ctx context.Context, symbol string, filter models.HistoryFilter) ([]models.BTC, error) {
 	var btc []models.BTC
-	var err error
-	var query string
-	if limit == 0 && offset == 0 {
-		query = fmt.Sprintf("SELECT * FROM bitcoin %s;", orderBy)
-		err = r.driver.DB.Select(&btc, query)
-	} else if limit != 0 && offset == 0 {
-		query = fmt.Sprintf("SELECT * FROM bitcoin %s LIMIT $1;", orderBy)
-		err = r.driver.DB.Select(&btc, query, limit)
-	} else if limit == 0 && offset != 0 {
-		query = fmt.Sprintf("SELECT * FROM bitcoin %s OFFSET $1;", orderBy)
-		err = r.driver.DB.Select(&btc, query, offset)
-	} else {
-		query = fmt.Sprintf("SELECT * FROM bitcoin %s LIMIT $1 OFFSET $2;", orderBy)
-		err = r.driver.DB.Select(&btc, query, limit, offset)
-	}
+	query := fmt.Sprintf(`%s
+	WHERE a.symbol = $1
+		AND ($2::timestamptz IS NULL OR q.created_at >= $2)
+		AND ($3::timestamptz IS NULL OR q.created_at < $3)
+		AND ($6::timestamptz IS NULL OR (q.created_at, q.id) > ($6, $7::bigint))
+		AND ($8::timestamptz IS NULL OR (q.created_at, q.id) < ($8, $9::bigint))
+	%s LIMIT $4 OFFSET $5;`, selectQuotes, filter.OrderBy)
+	args := append([]interface{}{symbol, filter.From, filter.To, limitOrNull(filter.Limit), filter.Offset}, keysetArgs(filter)...)
+	err := r.driver.DB.SelectContext(ctx, &btc, query, args...)
 	return btc, err
 }
 
-func (r *Repository) GetAllFiat(limit, offset int, orderBy string) ([]models.Fiat, error) {
+// CountBTC counts the records in the time range of the filter
+func (r *Repository) CountBTC(ctx context.Context, symbol string, filter models.HistoryFilter) (int, error) {
+	var count int
+	query := `
+	SELECT count(*) FROM quotes q JOIN assets a ON a.id = q.asset_id
+	WHERE a.symbol = $1
+		AND ($2::timestamptz IS NULL OR q.created_at >= $2)
+		AND ($3::timestamptz IS NULL OR q.created_at < $3)`
+	err := r.driver.DB.GetContext(ctx, &count, query, symbol, filter.From, filter.To)
+	return count, err
+}
+
+// GetAllFiat returns the snapshots with their values pivoted by char code into Rates, Currencies are not selected.
+// Rates are limited to filter.Codes unless they are nil. The snapshots are filtered and paged by their effective dates.
+func (r *Repository) GetAllFiat(ctx context.Context, source string, filter models.HistoryFilter) ([]models.Fiat, error) {
 	var fiat []models.Fiat
-	var err error
-	var query string
-	if limit == 0 && offset == 0 {
-		query = fmt.Sprintf("SELECT * FROM fiat %s;", orderBy)
-		err = r.driver.DB.Select(&fiat, query)
-	} else if limit != 0 && offset == 0 {
-		query = fmt.Sprintf("SELECT * FROM fiat %s LIMIT $1;", orderBy)
-		err = r.driver.DB.Select(&fiat, query, limit)
-	} else if limit == 0 && offset != 0 {
-		query = fmt.Sprintf("SELECT * FROM fiat %s OFFSET $1;", orderBy)
-		err = r.driver.DB.Select(&fiat, query, offset)
-	} else {
-		query = fmt.Sprintf("SELECT * FROM fiat %s LIMIT $1 OFFSET $2;", orderBy)
-		err = r.driver.DB.Select(&fiat, query, limit, offset)
-	}
+	query := fmt.Sprintf(`SELECT `+fiatColumns+`,
+		(SELECT jsonb_object_agg(c.char_code, r.value)
+		FROM fiat_rates r JOIN currencies c ON c.id = r.currency_id
+		WHERE r.snapshot_id = f.id AND ($10::text[] IS NULL OR c.char_code = ANY($10))) AS rates
+	FROM fiat f
+	WHERE source = $1
+		AND ($2::date IS NULL OR effective_date >= $2::date)
+		AND ($3::date IS NULL OR effective_date < $3::date)
+		AND ($6::date IS NULL OR (effective_date, id) > ($6::date, $7::bigint))
+		AND ($8::date IS NULL OR (effective_date, id) < ($8::date, $9::bigint))
+	%s LIMIT $4 OFFSET $5;`, filter.OrderBy)
+	args := append([]interface{}{source, dateOrNull(filter.From), dateOrNull(filter.To), limitOrNull(filter.Limit), filter.Offset},
+		keysetArgs(filter)...)
+	args = append(args, textArray(filter.Codes))
+	err := r.driver.DB.SelectContext(ctx, &fiat, query, args...)
 	return fiat, err
 }
+
+// CountFiat counts the records with the effective dates in the range of the filter
+func (r *Repository) CountFiat(ctx context.Context, source string, filter models.HistoryFilter) (int, error) {
+	var count int
+	query := `
+	SELECT count(*) FROM fiat
+	WHERE source = $1
+		AND ($2::date IS NULL OR effective_date >= $2::date)
+		AND ($3::date IS NULL OR effective_date < $3::date)`
+	err := r.driver.DB.GetContext(ctx, &count, query, source, dateOrNull(filter.From), dateOrNull(filter.To))
+	return count, err
+}
+
+// currencyPoints is the downsampled series of a currency up to the to date, the last rates of every bucket.
+// It is walked by the fiat_rates_currency_id_idx index.
+const currencyPoints = `
+	WITH points AS (
+		SELECT DISTINCT ON (bucket) date_trunc($3::text, f.effective_date::timestamp) AS bucket,
+			f.effective_date AS date, r.nominal, r.value
+		FROM currencies c
+			JOIN fiat_rates r ON r.currency_id = c.id
+			JOIN fiat f ON f.id = r.snapshot_id
+		WHERE c.char_code = $2 AND f.source = $1 AND ($5::date IS NULL OR f.effective_date <= $5::date)
+		ORDER BY bucket, f.effective_date DESC
+	)`
+
+// GetCurrencyHistory returns the points of the currency oldest first. The change of the first point in the range
+// is against the point before it, a different nominal of the previous point is scaled to the current one.
+func (r *Repository) GetCurrencyHistory(ctx context.Context, source string, filter models.CurrencyHistoryFilter) ([]models.CurrencyPoint, error) {
+	points := []models.CurrencyPoint{}
+	query := currencyPoints + `
+	SELECT date, nominal, value, change, change_pct FROM (
+		SELECT date, nominal, value,
+			value - lag(value) OVER w * nominal / lag(nominal) OVER w AS change,
+			round((value * lag(nominal) OVER w / (lag(value) OVER w * nominal) - 1) * 100, 4) AS change_pct
+		FROM points
+		WINDOW w AS (ORDER BY bucket)
+	) p
+	WHERE $4::date IS NULL OR date >= $4::date
+	ORDER BY date LIMIT $6 OFFSET $7`
+	err := r.driver.DB.SelectContext(ctx, &points, query, source, filter.CharCode, filter.Bucket,
+		dateOrNull(filter.From), dateOrNull(filter.To), limitOrNull(filter.Limit), filter.Offset)
+	return points, err
+}
+
+// CountCurrencyHistory counts the points of the currency in the date range of the filter
+func (r *Repository) CountCurrencyHistory(ctx context.Context, source string, filter models.CurrencyHistoryFilter) (int, error) {
+	var count int
+	query := currencyPoints + `
+	SELECT count(*) FROM points WHERE $4::date IS NULL OR date >= $4::date`
+	err := r.driver.DB.GetContext(ctx, &count, query, source, filter.CharCode, filter.Bucket,
+		dateOrNull(filter.From), dateOrNull(filter.To))
+	return count, err
+}
+
+// selectStats aggregates models.Stats from the samples(t, value) of a query,
+// the mean and the sample standard deviation keep 8 digits after the point
+const selectStats = `
+	SELECT s.*, s.last - s.first AS change, round((s.last / s.first - 1) * 100, 4) AS change_pct
+	FROM (
+		SELECT count(*) AS count, min(value) AS min, max(value) AS max,
+			round(avg(value), 8) AS mean, round(stddev_samp(value), 8) AS stddev,
+			(array_agg(value ORDER BY t))[1]      AS first,
+			(array_agg(value ORDER BY t DESC))[1] AS last
+		FROM samples
+	) s`
+
+// GetBTCStats aggregates the prices of the symbol created from..to inclusive
+func (r *Repository) GetBTCStats(ctx context.Context, symbol string, from, to time.Time) (*models.Stats, error) {
+	query := `
+	WITH samples AS (
+		SELECT q.created_at AS t, q.in_usdt AS value
+		FROM quotes q JOIN assets a ON a.id = q.asset_id
+		WHERE a.symbol = $1 AND q.created_at BETWEEN $2 AND $3
+	)` + selectStats
+	var stats models.Stats
+	err := r.driver.DB.GetContext(ctx, &stats, query, symbol, from, to)
+	return &stats, err
+}
+
+// GetCurrencyStats aggregates the values of the currency that were in effect from..to, the dates after from
+// and the rates in effect on the from date. Values with another nominal are scaled to the newest nominal.
+func (r *Repository) GetCurrencyStats(ctx context.Context, source, charCode string, from, to time.Time) (*models.Stats, error) {
+	query := `
+	WITH rates AS (
+		SELECT f.effective_date, r.nominal, r.value
+		FROM currencies c
+			JOIN fiat_rates r ON r.currency_id = c.id
+			JOIN fiat f ON f.id = r.snapshot_id
+		WHERE c.char_code = $2 AND f.source = $1 AND f.effective_date <= $4::date
+	), in_effect AS (
+		SELECT * FROM rates WHERE effective_date > $3::date
+		UNION ALL
+		(SELECT * FROM rates WHERE effective_date <= $3::date ORDER BY effective_date DESC LIMIT 1)
+	), samples AS (
+		SELECT effective_date AS t, value * first_value(nominal) OVER (ORDER BY effective_date DESC) / nominal AS value
+		FROM in_effect
+	)` + selectStats
+	var stats models.Stats
+	err := r.driver.DB.GetContext(ctx, &stats, query, source, charCode, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	return &stats, err
+}
+
+// dateOrNull formats the date of t as a query argument, NULL when it is not set
+func dateOrNull(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.Format("2006-01-02")
+}
+
+// keysetArgs returns the After and Before keys as query arguments, NULL when they are not set
+func keysetArgs(filter models.HistoryFilter) []interface{} {
+	args := make([]interface{}, 0, 4)
+	for _, key := range []*models.Keyset{filter.After, filter.Before} {
+		if key == nil {
+			args = append(args, nil, nil)
+			continue
+		}
+		args = append(args, key.Time, key.ID)
+	}
+	return args
+}
+
+// limitOrNull turns zero limit into NULL, LIMIT NULL is no limit in postgres
+func limitOrNull(limit int) interface{} {
+	if limit == 0 {
+		return nil
+	}
+	return limit
+}
+
+// GetCandles buckets quotes by interval, a postgres interval like '5 minutes'.
+// Buckets are aligned to 2001-01-01 UTC, so weeks start on Monday.
+func (r *Repository) GetCandles(ctx context.Context, symbol, interval string, from, to *time.Time) ([]models.Candle, error) {
+	candles := []models.Candle{}
+	query := `
+	SELECT date_bin($2::interval, q.created_at, TIMESTAMPTZ '2001-01-01') AS bucket,
+		(array_agg(q.in_usdt ORDER BY q.created_at))[1]      AS open,
+		max(q.in_usdt)                                       AS high,
+		min(q.in_usdt)                                       AS low,
+		(array_agg(q.in_usdt ORDER BY q.created_at DESC))[1] AS close,
+		count(*)                                             AS count
+	FROM quotes q JOIN assets a ON a.id = q.asset_id
+	WHERE a.symbol = $1
+		AND ($3::timestamptz IS NULL OR q.created_at >= $3)
+		AND ($4::timestamptz IS NULL OR q.created_at < $4)
+	GROUP BY bucket
+	ORDER BY bucket`
+	err := r.driver.DB.SelectContext(ctx, &candles, query, symbol, interval, from, to)
+	return candles, err
+}
+
+// GetPeakClose returns the highest close of the candles of the quotes before the time, invalid without quotes.
+// The candles are bucketed like in GetCandles.
+func (r *Repository) GetPeakClose(ctx context.Context, symbol, interval string, before time.Time) (decimal.NullDecimal, error) {
+	var peak decimal.NullDecimal
+	query := `
+	SELECT max(c.close) FROM (
+		SELECT (array_agg(q.in_usdt ORDER BY q.created_at DESC))[1] AS close
+		FROM quotes q JOIN assets a ON a.id = q.asset_id
+		WHERE a.symbol = $1 AND q.created_at < $3
+		GROUP BY date_bin($2::interval, q.created_at, TIMESTAMPTZ '2001-01-01')
+	) c`
+	err := r.driver.DB.GetContext(ctx, &peak, query, symbol, interval, before)
+	return peak, err
+}
@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+	cases := []struct {
+		spec string
+		from time.Time
+		exp  time.Time
+	}{
+		// Friday after the publication goes to Monday
+		{"30 15 * * MON-FRI", time.Date(2023, 3, 3, 15, 30, 0, 0, moscow), time.Date(2023, 3, 6, 15, 30, 0, 0, moscow)},
+		{"30 15 * * 1-5", time.Date(2023, 3, 6, 9, 0, 0, 0, moscow), time.Date(2023, 3, 6, 15, 30, 0, 0, moscow)},
+		// UTC input is compared in the schedule's timezone
+		{"30 15 * * 1-5", time.Date(2023, 3, 6, 12, 29, 0, 0, time.UTC), time.Date(2023, 3, 6, 15, 30, 0, 0, moscow)},
+		{"*/15 * * * *", time.Date(2023, 3, 6, 10, 16, 30, 0, moscow), time.Date(2023, 3, 6, 10, 30, 0, 0, moscow)},
+		{"0 0 1 * *", time.Date(2023, 12, 31, 23, 59, 0, 0, moscow), time.Date(2024, 1, 1, 0, 0, 0, 0, moscow)},
+		{"0 12 29 FEB *", time.Date(2023, 3, 1, 0, 0, 0, 0, moscow), time.Date(2024, 2, 29, 12, 0, 0, 0, moscow)},
+		// 7 is Sunday
+		{"0 8 * * 7", time.Date(2023, 3, 6, 0, 0, 0, 0, moscow), time.Date(2023, 3, 12, 8, 0, 0, 0, moscow)},
+		// both day fields restricted: the 10th or any Monday
+		{"0 0 10 * 1", time.Date(2023, 3, 7, 0, 0, 0, 0, moscow), time.Date(2023, 3, 10, 0, 0, 0, 0, moscow)},
+		{"5,10-12/2 3 * * *", time.Date(2023, 3, 6, 3, 6, 0, 0, moscow), time.Date(2023, 3, 6, 3, 10, 0, 0, moscow)},
+	}
+	for _, c := range cases {
+		schedule, err := ParseCron(c.spec, moscow)
+		require.NoError(t, err, c.spec)
+		require.True(t, c.exp.Equal(schedule.Next(c.from)), "%s from %s: got %s", c.spec, c.from, schedule.Next(c.from))
+	}
+}
+
+func TestCronNever(t *testing.T) {
+	schedule, err := ParseCron("0 0 31 2 *", time.UTC)
+	require.NoError(t, err)
+	require.True(t, schedule.Next(time.Now()).IsZero())
+}
+
+func TestParse(t *testing.T) {
+	schedule, err := Parse("10s", time.UTC)
+	require.NoError(t, err)
+	from := time.Date(2023, 3, 6, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, from.Add(10*time.Second), schedule.Next(from))
+
+	for _, spec := range []string{"", "-1s", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *",
+		"* * * * 8", "* * * * MON-", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		_, err := Parse(spec, time.UTC)
+		require.ErrorIs(t, err, ErrUnexpectedSchedule, spec)
+	}
+}
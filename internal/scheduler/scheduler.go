@@ -0,0 +1,110 @@
+// Package scheduler triggers jobs by interval or cron schedules with a random delay.
+package scheduler
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type (
+	Scheduler struct {
+		mu   sync.Mutex
+		jobs []*job
+		rnd  *rand.Rand
+	}
+	job struct {
+		name     string
+		schedule Schedule
+		jitter   time.Duration
+		run      func()
+		next     time.Time
+	}
+	// JobInfo describes a job, Next is the planned run with its jitter
+	JobInfo struct {
+		Name     string     `json:"name"`
+		Schedule string     `json:"schedule"`
+		Jitter   string     `json:"jitter"`
+		Next     *time.Time `json:"next"`
+	}
+)
+
+func New() *Scheduler {
+	return &Scheduler{rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// Add registers a job, run must not block the scheduler for long.
+// Every run is delayed by a random duration up to jitter.
+func (s *Scheduler) Add(name string, schedule Schedule, jitter time.Duration, run func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, &job{name: name, schedule: schedule, jitter: jitter, run: run})
+}
+
+// Run triggers the jobs until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	jobs := s.jobs
+	s.mu.Unlock()
+	wg := &sync.WaitGroup{}
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j *job) {
+			defer wg.Done()
+			s.runJob(ctx, j)
+		}(j)
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) runJob(ctx context.Context, j *job) {
+	planned := time.Now()
+	for {
+		// the schedule is followed from the planned times, so the runs don't drift
+		planned = j.schedule.Next(planned)
+		if now := time.Now(); planned.Before(now) {
+			planned = j.schedule.Next(now)
+		}
+		if planned.IsZero() {
+			return
+		}
+		next := planned.Add(s.delay(j.jitter))
+		s.mu.Lock()
+		j.next = next
+		s.mu.Unlock()
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			j.run()
+		}
+	}
+}
+
+func (s *Scheduler) delay(jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Duration(s.rnd.Int63n(int64(jitter)))
+}
+
+// Jobs returns the jobs with their next run times, Next is nil until the scheduler plans the job
+func (s *Scheduler) Jobs() []JobInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]JobInfo, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		info := JobInfo{Name: j.name, Schedule: j.schedule.String(), Jitter: j.jitter.String()}
+		if !j.next.IsZero() {
+			next := j.next
+			info.Next = &next
+		}
+		jobs = append(jobs, info)
+	}
+	return jobs
+}
@@ -0,0 +1,33 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerRun(t *testing.T) {
+	s := New()
+	var runs int32
+	s.Add("fast", Every(10*time.Millisecond), 5*time.Millisecond, func() { atomic.AddInt32(&runs, 1) })
+	s.Add("slow", Every(time.Hour), 0, func() { t.Error("slow job should not run") })
+	require.Nil(t, s.Jobs()[0].Next)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	jobs := s.Jobs()
+	require.Equal(t, "fast", jobs[0].Name)
+	require.Equal(t, "every 10ms", jobs[0].Schedule)
+	require.NotNil(t, jobs[1].Next)
+	require.WithinDuration(t, time.Now().Add(time.Hour), *jobs[1].Next, time.Second)
+	<-done
+	require.GreaterOrEqual(t, atomic.LoadInt32(&runs), int32(3))
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"XTechProject/internal/models"
+	"XTechProject/internal/services"
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/gorilla/schema"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// adminOnly lets through requests with "Authorization: Bearer <ADMIN_TOKEN>"
+func (s *Server) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type backfillResponse struct {
+	Status string `json:"status"`
+}
+
+// BackfillBTC starts filling gaps of a pair from exchange klines,
+// ?symbol=BTC-USDT&source=kucoin&interval=1m&from=2023-03-01&to=2023-03-02
+func (s *Server) BackfillBTC(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := &BackfillFilter{Symbol: models.SymbolBTCUSDT, Source: services.SourceKuCoin, Interval: "1m"}
+	if err := schema.NewDecoder().Decode(filter, r.Form); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Symbol = strings.ToUpper(filter.Symbol)
+	if err := s.service.StartBackfillBTC(services.BackfillParams(*filter)); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(backfillResponse{Status: "started"}); err != nil {
+		log.Println(err)
+	}
+}
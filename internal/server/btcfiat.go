@@ -7,10 +7,14 @@ import (
 )
 
 func (s *Server) LastBTCFiat(w http.ResponseWriter, r *http.Request) {
-	btc, err := s.service.GetLastBTC()
+	symbol, ok := s.symbol(w, r)
+	if !ok {
+		return
+	}
+	btc, err := s.service.GetLastBTCFiat(r.Context(), symbol, r.FormValue("symbols"))
 	if err != nil {
 		log.Println(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 	if err := json.NewEncoder(w).Encode(&btc.BTCToFiat); err != nil {
@@ -1,20 +1,29 @@
 package server
 
 import (
+	"XTechProject/internal/models"
+	"XTechProject/internal/services"
 	"encoding/json"
+	"github.com/gorilla/mux"
 	"github.com/gorilla/schema"
+	"github.com/shopspring/decimal"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 )
 
 type lastBTCResponse struct {
-	Value    float64    `json:"value"`
-	Datetime *time.Time `json:"datetime"`
+	Value    decimal.Decimal `json:"value"`
+	Datetime *time.Time      `json:"datetime"`
 }
 
 func (s *Server) LatestBTCUSDT(w http.ResponseWriter, r *http.Request) {
-	model, err := s.service.GetLastBTC()
+	symbol, ok := s.symbol(w, r)
+	if !ok {
+		return
+	}
+	model, err := s.service.GetLastBTC(r.Context(), symbol)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -33,17 +42,24 @@ func (s *Server) LatestBTCUSDT(w http.ResponseWriter, r *http.Request) {
 }
 
 type BTCHistoryResponse struct {
-	Total   int          `json:"total"`
-	History []BTCHistory `json:"history"`
+	Total      int          `json:"total"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+	PrevCursor string       `json:"prev_cursor,omitempty"`
+	History    []BTCHistory `json:"history"`
 }
 
 type BTCHistory struct {
-	Value  float64 `json:"value"`
-	Date   string  `json:"date"`
-	Latest bool    `json:"latest"`
+	Value      decimal.Decimal `json:"value"`
+	Date       string          `json:"date"`
+	Latest     bool            `json:"latest"`
+	Backfilled bool            `json:"backfilled,omitempty"`
 }
 
 func (s *Server) BTCUSDTWithHistory(w http.ResponseWriter, r *http.Request) {
+	symbol, ok := s.symbol(w, r)
+	if !ok {
+		return
+	}
 	if err := r.ParseForm(); err != nil {
 		log.Println(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -55,27 +71,120 @@ func (s *Server) BTCUSDTWithHistory(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	models, err := s.service.GetAllBTC(filter.Limit, filter.Offset, filter.OrderBy)
+	models, page, err := s.service.GetAllBTC(r.Context(), symbol, services.HistoryParams(*filter))
 	if err != nil {
 		log.Println(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), httpStatus(err))
 		return
 	}
 	var history []BTCHistory
 	for _, m := range models {
 		history = append(history, BTCHistory{
-			Value:  m.InUSDT,
-			Date:   m.CreatedAt.Format(time.RFC3339[:19]),
-			Latest: m.Latest,
+			Value:      m.InUSDT,
+			Date:       m.CreatedAt.Format(time.RFC3339[:19]),
+			Latest:     m.Latest,
+			Backfilled: m.Backfilled,
 		})
 	}
 	response := BTCHistoryResponse{
-		Total:   len(history),
-		History: history,
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+		History:    history,
 	}
-	json.Marshal(response)
 	if err := json.NewEncoder(w).Encode(&response); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// BTCQuotes returns the exchange quotes a BTC record was built from
+func (s *Server) BTCQuotes(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	quotes, err := s.service.GetBTCQuotes(r.Context(), id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(&quotes); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+type CandlesResponse struct {
+	Interval string          `json:"interval"`
+	Candles  []models.Candle `json:"candles"`
+}
+
+// Candles returns OHLC buckets of the pair, ?interval=1h&from=2023-03-01&to=2023-03-07T12:00:00Z
+func (s *Server) Candles(w http.ResponseWriter, r *http.Request) {
+	symbol, ok := s.symbol(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := &CandlesFilter{Interval: "1h"}
+	if err := schema.NewDecoder().Decode(filter, r.Form); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	candles, err := s.service.GetCandles(r.Context(), symbol, filter.Interval, filter.From, filter.To)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	response := CandlesResponse{
+		Interval: filter.Interval,
+		Candles:  candles,
+	}
+	if err := json.NewEncoder(w).Encode(&response); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Indicators returns an indicator of the pair candles, ?type=ema&period=20&interval=1h&from=2023-03-01
+func (s *Server) Indicators(w http.ResponseWriter, r *http.Request) {
+	symbol, ok := s.symbol(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := new(IndicatorsFilter)
+	if err := schema.NewDecoder().Decode(filter, r.Form); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	series, err := s.service.GetIndicator(r.Context(), symbol, services.IndicatorParams(*filter))
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	if err := json.NewEncoder(w).Encode(series); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
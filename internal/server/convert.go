@@ -0,0 +1,64 @@
+package server
+
+import (
+	"XTechProject/internal/services"
+	"encoding/json"
+	"github.com/gorilla/schema"
+	"log"
+	"net/http"
+)
+
+// Convert prices an amount of one currency in another,
+// ?from=EUR&to=BTC&amount=100&at=2024-01-01T00:00:00Z
+func (s *Server) Convert(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := new(ConvertFilter)
+	if err := schema.NewDecoder().Decode(filter, r.Form); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	conversion, err := s.service.Convert(r.Context(), services.ConvertParams(*filter))
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	if err := json.NewEncoder(w).Encode(conversion); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Matrix returns the cross rates of the base and the symbols, ?base=USD&symbols=EUR,JPY,BTC&at=2024-01-01
+func (s *Server) Matrix(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := new(MatrixFilter)
+	if err := schema.NewDecoder().Decode(filter, r.Form); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	matrix, err := s.service.Matrix(r.Context(), services.MatrixParams(*filter))
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	if err := json.NewEncoder(w).Encode(matrix); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -1,28 +1,33 @@
 package server
 
 import (
-	"XTechProject/internal/models"
+	"XTechProject/internal/services"
 	"encoding/json"
+	"github.com/gorilla/mux"
 	"github.com/gorilla/schema"
+	"github.com/shopspring/decimal"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 )
 
 type lastFiatResponse struct {
 	Date    string          `json:"date"`
+	Base    string          `json:"base"`
 	Valutes json.RawMessage `json:"valutes"`
 }
 
 func (s *Server) LastFiat(w http.ResponseWriter, r *http.Request) {
-	model, err := s.service.GetLastFiat()
+	model, err := s.service.GetLastFiat(r.Context(), r.FormValue("symbols"))
 	if err != nil {
 		log.Println(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 	resp := lastFiatResponse{
-		Date:    model.CreatedAt.Format(time.RFC3339[:10]),
+		Date:    model.EffectiveDate.Format(time.RFC3339[:10]),
+		Base:    model.Base,
 		Valutes: model.Currencies,
 	}
 	if err := json.NewEncoder(w).Encode(&resp); err != nil {
@@ -34,8 +39,10 @@ func (s *Server) LastFiat(w http.ResponseWriter, r *http.Request) {
 }
 
 type FiatHistoryResponse struct {
-	Total   int                      `json:"total"`
-	History []map[string]interface{} `json:"history"`
+	Total      int                      `json:"total"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+	PrevCursor string                   `json:"prev_cursor,omitempty"`
+	History    []map[string]interface{} `json:"history"`
 }
 
 func (s *Server) FiatHistory(w http.ResponseWriter, r *http.Request) {
@@ -44,33 +51,96 @@ func (s *Server) FiatHistory(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	filter := new(Filter)
+	filter := new(FiatFilter)
 	if err := schema.NewDecoder().Decode(filter, r.Form); err != nil {
 		log.Println(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	modelsData, err := s.service.GetFiatHistory(filter.Limit, filter.Offset, filter.OrderBy)
+	modelsData, page, err := s.service.GetFiatHistory(r.Context(), services.HistoryParams(filter.Filter), filter.Symbols)
 	if err != nil {
 		log.Println(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
-	history := make([]map[string]interface{}, 0, len(modelsData)*34)
+	history := make([]map[string]interface{}, 0, len(modelsData))
 	for _, m := range modelsData {
-		var currencies []models.Currency
-		json.Unmarshal(m.Currencies, &currencies)
-		body := make(map[string]interface{}, 34)
-		for _, v := range currencies {
-			body[v.CharCode] = v.Val
+		body := make(map[string]interface{}, len(m.Rates)+2)
+		for code, value := range m.Rates {
+			body[code] = value
 		}
-		body["date"] = m.CreatedAt.Format(time.RFC3339[:10])
+		body["date"] = m.EffectiveDate.Format(time.RFC3339[:10])
 		body["latest"] = m.Latest
 		history = append(history, body)
 	}
 	response := FiatHistoryResponse{
-		Total:   len(history),
-		History: history,
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+		History:    history,
+	}
+	if err := json.NewEncoder(w).Encode(&response); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+type CurrencyHistoryResponse struct {
+	CharCode string            `json:"char_code"`
+	Total    int               `json:"total"`
+	History  []CurrencyHistory `json:"history"`
+}
+
+type CurrencyHistory struct {
+	Date      string              `json:"date"`
+	Value     decimal.Decimal     `json:"value"`
+	Nominal   int                 `json:"nominal"`
+	Change    decimal.NullDecimal `json:"change"`
+	ChangePct decimal.NullDecimal `json:"change_pct"`
+}
+
+func (s *Server) CurrencyHistory(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	filter := new(CurrencyHistoryFilter)
+	if err := schema.NewDecoder().Decode(filter, r.Form); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	params := services.CurrencyHistoryParams{
+		CharCode: mux.Vars(r)["char_code"],
+		Interval: filter.Interval,
+		From:     filter.From,
+		To:       filter.To,
+		Limit:    filter.Limit,
+		Offset:   filter.Offset,
+	}
+	points, page, err := s.service.GetCurrencyHistory(r.Context(), params)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	history := make([]CurrencyHistory, 0, len(points))
+	for _, p := range points {
+		history = append(history, CurrencyHistory{
+			Date:      p.Date.Format(time.RFC3339[:10]),
+			Value:     p.Value,
+			Nominal:   p.Nominal,
+			Change:    p.Change,
+			ChangePct: p.ChangePct,
+		})
+	}
+	response := CurrencyHistoryResponse{
+		CharCode: strings.ToUpper(params.CharCode),
+		Total:    page.Total,
+		History:  history,
 	}
 	if err := json.NewEncoder(w).Encode(&response); err != nil {
 		log.Println(err)
@@ -1,9 +1,15 @@
 package server
 
 import (
+	"XTechProject/internal/analytics"
+	"XTechProject/internal/models"
 	"XTechProject/internal/services"
+	"encoding/json"
+	"errors"
 	"github.com/gorilla/mux"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -11,17 +17,65 @@ type (
 	Server struct {
 		*http.Server
 		service services.Servicer
+		// adminToken guards /api/admin, the routes are disabled when it is empty
+		adminToken string
 	}
 	Filter struct {
 		Offset  int    `schema:"offset"`
 		Limit   int    `schema:"limit"`
 		OrderBy string `schema:"order_by"`
+		From    string `schema:"from"`
+		To      string `schema:"to"`
+		Cursor  string `schema:"cursor"`
+	}
+	// FiatFilter is the history filter of fiat, Symbols are comma separated currencies to return
+	FiatFilter struct {
+		Filter
+		Symbols string `schema:"symbols"`
+	}
+	BackfillFilter struct {
+		Symbol   string `schema:"symbol"`
+		Source   string `schema:"source"`
+		Interval string `schema:"interval"`
+		From     string `schema:"from"`
+		To       string `schema:"to"`
+	}
+	ConvertFilter struct {
+		From   string `schema:"from"`
+		To     string `schema:"to"`
+		Amount string `schema:"amount"`
+		At     string `schema:"at"`
+	}
+	MatrixFilter struct {
+		Base    string `schema:"base"`
+		Symbols string `schema:"symbols"`
+		At      string `schema:"at"`
+	}
+	CurrencyHistoryFilter struct {
+		Interval string `schema:"interval"`
+		From     string `schema:"from"`
+		To       string `schema:"to"`
+		Limit    int    `schema:"limit"`
+		Offset   int    `schema:"offset"`
+	}
+	IndicatorsFilter struct {
+		Type     string `schema:"type"`
+		Period   int    `schema:"period"`
+		Interval string `schema:"interval"`
+		From     string `schema:"from"`
+		To       string `schema:"to"`
+	}
+	CandlesFilter struct {
+		Interval string `schema:"interval"`
+		From     string `schema:"from"`
+		To       string `schema:"to"`
 	}
 )
 
-func NewServer(port string, service *services.ManagementService) *Server {
+func NewServer(port, adminToken string, service *services.ManagementService) *Server {
 	srv := &Server{
-		service: service,
+		service:    service,
+		adminToken: adminToken,
 	}
 
 	srv.Server = &http.Server{
@@ -41,11 +95,121 @@ func (s *Server) Handler() *mux.Router {
 
 	router.HandleFunc("/btcusdt", s.LatestBTCUSDT).Methods(http.MethodGet)
 	router.HandleFunc("/btcusdt", s.BTCUSDTWithHistory).Methods(http.MethodPost)
+	router.HandleFunc("/btcusdt/{id:[0-9]+}/quotes", s.BTCQuotes).Methods(http.MethodGet)
+	router.HandleFunc("/btcusdt/candles", s.Candles).Methods(http.MethodGet)
+	router.HandleFunc("/btcusdt/stats", s.BTCStats).Methods(http.MethodGet)
+	router.HandleFunc("/btcusdt/indicators", s.Indicators).Methods(http.MethodGet)
 
 	router.HandleFunc("/currencies", s.LastFiat).Methods(http.MethodGet)
 	router.HandleFunc("/currencies", s.FiatHistory).Methods(http.MethodPost)
+	router.HandleFunc("/currencies/{char_code:[A-Za-z]{3}}/history", s.CurrencyHistory).Methods(http.MethodGet)
+	router.HandleFunc("/currencies/{char_code:[A-Za-z]{3}}/stats", s.CurrencyStats).Methods(http.MethodGet)
 
 	router.HandleFunc("/latest", s.LastBTCFiat).Methods(http.MethodGet)
+	router.HandleFunc("/convert", s.Convert).Methods(http.MethodGet)
+	router.HandleFunc("/matrix", s.Matrix).Methods(http.MethodGet)
+
+	router.HandleFunc("/schedule", s.Schedule).Methods(http.MethodGet)
+	router.HandleFunc("/sources", s.Sources).Methods(http.MethodGet)
+
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(s.adminOnly)
+	admin.HandleFunc("/backfill/btc", s.BackfillBTC).Methods(http.MethodPost)
+
+	// /api/btcusdt routes are aliases of the BTC-USDT pair
+	router.HandleFunc("/pairs", s.Pairs).Methods(http.MethodGet)
+	router.HandleFunc("/pairs/{symbol}", s.LatestBTCUSDT).Methods(http.MethodGet)
+	router.HandleFunc("/pairs/{symbol}/history", s.BTCUSDTWithHistory).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/pairs/{symbol}/fiat", s.LastBTCFiat).Methods(http.MethodGet)
+	router.HandleFunc("/pairs/{symbol}/candles", s.Candles).Methods(http.MethodGet)
+	router.HandleFunc("/pairs/{symbol}/stats", s.BTCStats).Methods(http.MethodGet)
+	router.HandleFunc("/pairs/{symbol}/indicators", s.Indicators).Methods(http.MethodGet)
 
 	return r
 }
+
+// symbol returns the pair from the path, BTC-USDT for the /api/btcusdt aliases.
+// It writes 404 and returns false for pairs that are not tracked.
+func (s *Server) symbol(w http.ResponseWriter, r *http.Request) (string, bool) {
+	symbol, ok := mux.Vars(r)["symbol"]
+	if !ok {
+		return models.SymbolBTCUSDT, true
+	}
+	symbol = strings.ToUpper(symbol)
+	if err := s.service.CheckSymbol(symbol); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return "", false
+	}
+	return symbol, true
+}
+
+// httpStatus is 400 for wrong request parameters, 404 for missing data and 500 for everything else
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUnexpectedOrderBy),
+		errors.Is(err, services.ErrUnexpectedInterval),
+		errors.Is(err, services.ErrUnexpectedWindow),
+		errors.Is(err, analytics.ErrUnknownIndicator),
+		errors.Is(err, analytics.ErrUnexpectedPeriod),
+		errors.Is(err, services.ErrUnexpectedTime),
+		errors.Is(err, services.ErrUnexpectedCursor),
+		errors.Is(err, services.ErrUnknownPriceSource),
+		errors.Is(err, services.ErrNoHistory),
+		errors.Is(err, services.ErrUnknownCurrency),
+		errors.Is(err, services.ErrUnexpectedAmount):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrUnknownSymbol),
+		errors.Is(err, services.ErrNoRates):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+type errorResponse struct {
+	Error   string   `json:"error"`
+	Unknown []string `json:"unknown,omitempty"`
+}
+
+// writeError writes err with its status, unknown currencies are a JSON 400 that lists them
+func writeError(w http.ResponseWriter, err error) {
+	var unknown *services.UnknownCurrenciesError
+	if !errors.As(err, &unknown) {
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(errorResponse{Error: services.ErrUnknownCurrency.Error(), Unknown: unknown.Codes}); err != nil {
+		log.Println(err)
+	}
+}
+
+func (s *Server) Pairs(w http.ResponseWriter, r *http.Request) {
+	if err := json.NewEncoder(w).Encode(s.service.Symbols()); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Schedule returns the worker jobs with their next run times
+func (s *Server) Schedule(w http.ResponseWriter, r *http.Request) {
+	if err := json.NewEncoder(w).Encode(s.service.Schedule()); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Sources returns the circuit breaker states of the upstream sources
+func (s *Server) Sources(w http.ResponseWriter, r *http.Request) {
+	if err := json.NewEncoder(w).Encode(s.service.Sources()); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+)
+
+// BTCStats returns the aggregates of the pair prices, ?window=24h|7d|30d
+func (s *Server) BTCStats(w http.ResponseWriter, r *http.Request) {
+	symbol, ok := s.symbol(w, r)
+	if !ok {
+		return
+	}
+	stats, err := s.service.GetBTCStats(r.Context(), symbol, r.FormValue("window"))
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// CurrencyStats returns the aggregates of the currency rates, ?window=24h|7d|30d
+func (s *Server) CurrencyStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.service.GetCurrencyStats(r.Context(), mux.Vars(r)["char_code"], r.FormValue("window"))
+	if err != nil {
+		log.Println(err)
+		writeError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"XTechProject/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"log"
+	"sort"
+	"time"
+)
+
+var ErrNoHistory = errors.New("source has no history")
+
+// BackfillParams are the request parameters of a BTC backfill, times are RFC3339 or YYYY-MM-DD
+type BackfillParams struct {
+	Symbol   string
+	Source   string
+	Interval string
+	From     string
+	To       string
+}
+
+// defaultBackfillDelay is the pause between requests of backfills started by the API
+const defaultBackfillDelay = time.Second
+
+// BTCBackfill is a range of a pair to fill from the klines of a price source
+type BTCBackfill struct {
+	Symbol   string
+	Source   string
+	Interval string
+	From, To time.Time
+	// Delay is the pause between requests to the source
+	Delay time.Duration
+}
+
+// ratesGap is the longest run of days without own rates that is taken as weekends and holidays
+const ratesGap = 7 * 24 * time.Hour
+
+// BackfillFiat stores the rates of the source for every day from..to that has no rates yet.
+// Requests are made one by one with delay between them, rows are stamped with the effective date of the rates,
+// a date stored meanwhile by the worker is skipped. A day between stored dates less than ratesGap after
+// the previous one is covered by its rates, so reruns don't request weekends and holidays again.
+func (svc *ManagementService) BackfillFiat(ctx context.Context, source string, from, to time.Time, delay time.Duration) (int, error) {
+	from, to = truncateDay(from), truncateDay(to)
+	if to.Before(from) {
+		return 0, fmt.Errorf("%w: from %s is after to %s", ErrUnexpectedTime, from.Format(time.RFC3339[:10]), to.Format(time.RFC3339[:10]))
+	}
+	fiatSource, err := svc.fiatSource(source)
+	if err != nil {
+		return 0, err
+	}
+	historical, ok := fiatSource.(HistoricalFiatSource)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrNoHistory, source)
+	}
+	// rates of a weekend are effective from the working day before it
+	dates, err := svc.db.GetFiatDates(ctx, source, from.Add(-ratesGap), to.Add(ratesGap))
+	if err != nil {
+		return 0, fmt.Errorf("error in GetFiatDates: %w", err)
+	}
+	stored := make(map[time.Time]bool, len(dates))
+	for _, d := range dates {
+		stored[truncateDay(d)] = true
+	}
+	var created int
+	for day, first := from, true; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if stored[day] || coveredDay(dates, day) {
+			continue
+		}
+		if !first {
+			if err := sleep(ctx, delay); err != nil {
+				return created, err
+			}
+		}
+		first = false
+		model, err := historical.GetFiatOn(ctx, day)
+		if err != nil {
+			return created, fmt.Errorf("error in GetFiatOn(%s): %w", day.Format(time.RFC3339[:10]), err)
+		}
+		effective := truncateDay(*model.EffectiveDate)
+		if stored[effective] {
+			continue
+		}
+		model.CreatedAt, model.EffectiveDate = &effective, &effective
+		ok, err := svc.db.CreateFiatHistoryRecord(ctx, model)
+		if err != nil {
+			return created, fmt.Errorf("error in CreateFiatHistoryRecord: %w", err)
+		}
+		stored[effective] = true
+		if !ok {
+			continue
+		}
+		created++
+		log.Printf("Fiat from %s for %s stored\n", source, effective.Format(time.RFC3339[:10]))
+	}
+	return created, nil
+}
+
+// coveredDay tells if the day lies between stored dates sorted ascending, less than ratesGap after the previous one
+func coveredDay(dates []time.Time, day time.Time) bool {
+	i := sort.Search(len(dates), func(i int) bool { return !truncateDay(dates[i]).Before(day) })
+	if i == 0 || i == len(dates) {
+		return false
+	}
+	return day.Sub(truncateDay(dates[i-1])) < ratesGap
+}
+
+// StartBackfillBTC checks the backfill and runs it in the background, it is waited for on shutdown.
+// To is now when it is empty.
+func (svc *ManagementService) StartBackfillBTC(req BackfillParams) error {
+	fromTime, err := parseTime(req.From)
+	if err != nil {
+		return err
+	}
+	if fromTime == nil {
+		return fmt.Errorf("%w: from is required", ErrUnexpectedTime)
+	}
+	toTime, err := parseTime(req.To)
+	if err != nil {
+		return err
+	}
+	if toTime == nil {
+		now := time.Now()
+		toTime = &now
+	}
+	params := BTCBackfill{
+		Symbol:   req.Symbol,
+		Source:   req.Source,
+		Interval: req.Interval,
+		From:     *fromTime,
+		To:       *toTime,
+		Delay:    defaultBackfillDelay,
+	}
+	if _, _, err := svc.klineSource(params); err != nil {
+		return err
+	}
+	svc.goWorker(func(ctx context.Context) {
+		created, err := svc.BackfillBTC(ctx, params)
+		if err != nil {
+			log.Printf("BackfillBTC: error for %s, err: %s", params.Symbol, err.Error())
+		}
+		log.Printf("BackfillBTC: %d record(s) of %s stored", created, params.Symbol)
+	})
+	return nil
+}
+
+// BackfillBTC stores a record for every kline from..to that falls into a gap of the pair's records.
+// The close price of a kline is known at its end, so the record is stamped with the close time
+// and klines that don't close by to are skipped. The records are flagged as backfilled with the kline interval,
+// are never latest and are priced in fiat with the rates that were in effect at their time.
+func (svc *ManagementService) BackfillBTC(ctx context.Context, params BTCBackfill) (int, error) {
+	source, step, err := svc.klineSource(params)
+	if err != nil {
+		return 0, err
+	}
+	rates := make(map[time.Time]*models.Fiat)
+	var created int
+	for from, first := params.From, true; from.Before(params.To); from = from.Add(step * klinesPerRequest) {
+		if !first {
+			if err := sleep(ctx, params.Delay); err != nil {
+				return created, err
+			}
+		}
+		first = false
+		to := from.Add(step * klinesPerRequest)
+		if to.After(params.To) {
+			to = params.To
+		}
+		klines, err := source.GetKlines(ctx, params.Symbol, params.Interval, from, to)
+		if err != nil {
+			return created, fmt.Errorf("error in GetKlines: %w", err)
+		}
+		records := make([]models.BTC, 0, len(klines))
+		for _, k := range klines {
+			createdAt := k.Time.Add(step)
+			if createdAt.After(params.To) {
+				continue
+			}
+			price, err := decimal.NewFromString(k.Close)
+			if err != nil {
+				return created, fmt.Errorf("%w: price %s", ErrUnexpectedResponse, k.Close)
+			}
+			record := models.BTC{
+				Symbol:     params.Symbol,
+				InUSDT:     price,
+				CreatedAt:  &createdAt,
+				Backfilled: true,
+				Interval:   params.Interval,
+			}
+			if err := svc.priceBackfilled(ctx, &record, rates); err != nil {
+				return created, err
+			}
+			records = append(records, record)
+		}
+		n, err := svc.db.CreateBackfilledBTCRecords(ctx, records, step)
+		if err != nil {
+			return created, fmt.Errorf("error in CreateBackfilledBTCRecords: %w", err)
+		}
+		created += n
+	}
+	return created, nil
+}
+
+// priceBackfilled sets the fiat prices of the record with the rates of the primary source in effect at its time.
+// rates caches the rates by the date they were looked up for.
+func (svc *ManagementService) priceBackfilled(ctx context.Context, record *models.BTC, rates map[time.Time]*models.Fiat) error {
+	source := svc.primaryFiatSource()
+	date := fiatDate(source, *record.CreatedAt)
+	fiat, ok := rates[date]
+	if !ok {
+		var err error
+		fiat, err = svc.db.GetFiatAsOf(ctx, source, date)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s fiat on %s, backfill the rates first", ErrNoRates, source, date.Format(time.RFC3339[:10]))
+		}
+		if err != nil {
+			return fmt.Errorf("error in GetFiatAsOf: %w", err)
+		}
+		rates[date] = fiat
+	}
+	btcToFiat, err := svc.priceInFiat(record, fiat)
+	if err != nil {
+		return err
+	}
+	if record.BTCToFiat, err = json.Marshal(btcToFiat); err != nil {
+		return fmt.Errorf("error in json.Marshal(btcToFiat), err: %w", err)
+	}
+	return nil
+}
+
+// klineSource checks the backfill parameters and returns its source with the kline size
+func (svc *ManagementService) klineSource(params BTCBackfill) (KlineSource, time.Duration, error) {
+	if err := svc.CheckSymbol(params.Symbol); err != nil {
+		return nil, 0, err
+	}
+	step, ok := klineIntervals[params.Interval]
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %s", ErrUnexpectedInterval, params.Interval)
+	}
+	if !params.From.Before(params.To) {
+		return nil, 0, fmt.Errorf("%w: from must be before to", ErrUnexpectedTime)
+	}
+	var source PriceSource
+	for _, s := range svc.prices {
+		if s.Name() == params.Source {
+			source = s
+		}
+	}
+	if source == nil {
+		var err error
+		if source, err = NewPriceSource(params.Source, svc.cfg); err != nil {
+			return nil, 0, err
+		}
+	}
+	klines, ok := source.(KlineSource)
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %s", ErrNoHistory, params.Source)
+	}
+	return klines, step, nil
+}
+
+// fiatSource returns the configured source by name, other known sources are created on demand
+func (svc *ManagementService) fiatSource(name string) (FiatSource, error) {
+	for _, s := range svc.fiats {
+		if s.Name() == name {
+			return s, nil
+		}
+	}
+	return NewFiatSource(name, svc.cfg)
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// sleep waits for d unless ctx is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"XTechProject/cmd/config"
+	"XTechProject/internal/models"
+	mock_repository "XTechProject/internal/repository/mocks"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBackfillFiat(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	// the weekend has the rates of Saturday
+	effective := map[string]string{"04/03/2023": "04.03.2023", "05/03/2023": "04.03.2023", "06/03/2023": "06.03.2023"}
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		date := r.URL.Query().Get("date_req")
+		requested = append(requested, date)
+		fmt.Fprintf(w, `<ValCurs Date=%q><Valute ID="R01235"><CharCode>USD</CharCode><Nominal>1</Nominal><Value>75,1</Value></Valute></ValCurs>`, effective[date])
+	}))
+	defer srv.Close()
+	cfg, err := config.New()
+	require.NoError(t, err)
+	cfg.URLs.Fiat = srv.URL
+	svc, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+
+	day := func(d int) time.Time { return time.Date(2023, 3, d, 0, 0, 0, 0, time.UTC) }
+	repo.EXPECT().GetFiatDates(gomock.Any(), FiatSourceCBR, day(3).AddDate(0, 0, -7), day(6).AddDate(0, 0, 7)).
+		Return([]time.Time{day(3)}, nil).Times(1)
+	var created []time.Time
+	repo.EXPECT().CreateFiatHistoryRecord(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, model *models.Fiat) (bool, error) {
+			require.Equal(t, FiatSourceCBR, model.Source)
+			require.False(t, model.Latest)
+			require.Equal(t, *model.EffectiveDate, *model.CreatedAt)
+			created = append(created, *model.EffectiveDate)
+			return true, nil
+		}).Times(2)
+	n, err := svc.BackfillFiat(context.Background(), FiatSourceCBR, day(3), day(6), 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, []string{"04/03/2023", "05/03/2023", "06/03/2023"}, requested)
+	require.Equal(t, []time.Time{day(4), day(6)}, created)
+
+	// a rerun doesn't request the Sunday covered by the rates of Saturday
+	requested = nil
+	repo.EXPECT().GetFiatDates(gomock.Any(), FiatSourceCBR, gomock.Any(), gomock.Any()).
+		Return([]time.Time{day(3), day(4), day(6)}, nil).Times(1)
+	n, err = svc.BackfillFiat(context.Background(), FiatSourceCBR, day(3), day(6), 0)
+	require.NoError(t, err)
+	require.Zero(t, n)
+	require.Empty(t, requested)
+	// days of a longer gap are requested, so are the days after the last stored date
+	require.True(t, coveredDay([]time.Time{day(1), day(10)}, day(7)))
+	require.False(t, coveredDay([]time.Time{day(1), day(10)}, day(8)))
+	require.False(t, coveredDay([]time.Time{day(1)}, day(2)))
+
+	_, err = svc.BackfillFiat(context.Background(), FiatSourceECB, day(3), day(6), 0)
+	require.ErrorIs(t, err, ErrNoHistory)
+	_, err = svc.BackfillFiat(context.Background(), FiatSourceCBR, day(6), day(3), 0)
+	require.ErrorIs(t, err, ErrUnexpectedTime)
+}
+
+func TestBackfillBTC(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	from := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		start := r.URL.Query().Get("startAt")
+		fmt.Fprintf(w, `{"code":"200000","data":[["%s","1","23140.5","1","1","1","1"]]}`, start)
+	}))
+	defer srv.Close()
+	cfg, err := config.New()
+	require.NoError(t, err)
+	cfg.URLs.KuCoin = srv.URL
+	svc, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+
+	// one request per klinesPerRequest klines
+	to := from.Add(klinesPerRequest*time.Hour + time.Hour)
+	second := from.Add(klinesPerRequest * time.Hour)
+	currencies, err := json.Marshal([]models.Currency{{CharCode: "USD", Nominal: 1, Val: decimal.NewFromInt(80)}})
+	require.NoError(t, err)
+	fiat := &models.Fiat{Source: FiatSourceCBR, Base: "RUB", USDRUB: decimal.NewFromInt(80), Currencies: currencies}
+	repo.EXPECT().GetFiatAsOf(gomock.Any(), FiatSourceCBR, from).Return(fiat, nil).Times(1)
+	repo.EXPECT().GetFiatAsOf(gomock.Any(), FiatSourceCBR, truncateDay(second)).Return(fiat, nil).Times(1)
+	var stored []models.BTC
+	repo.EXPECT().CreateBackfilledBTCRecords(gomock.Any(), gomock.Any(), time.Hour).DoAndReturn(
+		func(_ context.Context, records []models.BTC, _ time.Duration) (int, error) {
+			stored = append(stored, records...)
+			return 1, nil
+		}).Times(2)
+	params := BTCBackfill{Symbol: models.SymbolBTCUSDT, Source: SourceKuCoin, Interval: "1h", From: from, To: to}
+	n, err := svc.BackfillBTC(context.Background(), params)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, 2, requests)
+	require.Len(t, stored, 2)
+	// the close price is stamped with the close time of the kline
+	for i, open := range []time.Time{from, second} {
+		require.Equal(t, open.Add(time.Hour), *stored[i].CreatedAt)
+		require.True(t, stored[i].Backfilled)
+		requireDecimal(t, "23140.5", stored[i].InUSDT)
+		requireDecimal(t, "1851240", stored[i].InRub)
+		require.JSONEq(t, `{"USD":23140.5,"RUB":1851240}`, string(stored[i].BTCToFiat))
+	}
+
+	// the last kline doesn't close by to
+	params.To = to.Add(-time.Minute)
+	repo.EXPECT().CreateBackfilledBTCRecords(gomock.Any(), gomock.Len(0), time.Hour).Return(0, nil).Times(1)
+	repo.EXPECT().GetFiatAsOf(gomock.Any(), FiatSourceCBR, from).Return(fiat, nil).Times(1)
+	repo.EXPECT().CreateBackfilledBTCRecords(gomock.Any(), gomock.Len(1), time.Hour).Return(1, nil).Times(1)
+	_, err = svc.BackfillBTC(context.Background(), params)
+	require.NoError(t, err)
+
+	// records are not stored without the rates of their time
+	repo.EXPECT().GetFiatAsOf(gomock.Any(), FiatSourceCBR, from).Return(nil, sql.ErrNoRows).Times(1)
+	_, err = svc.BackfillBTC(context.Background(), params)
+	require.ErrorIs(t, err, ErrNoRates)
+}
+
+func TestBackfillBTCError(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	cfg, err := config.New()
+	require.NoError(t, err)
+	svc, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+	from := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	valid := BTCBackfill{Symbol: models.SymbolBTCUSDT, Source: SourceKuCoin, Interval: "1m", From: from, To: from.Add(time.Hour)}
+	cases := []struct {
+		change func(p *BTCBackfill)
+		err    error
+	}{
+		{func(p *BTCBackfill) { p.Symbol = "ETH-USDT" }, ErrUnknownSymbol},
+		{func(p *BTCBackfill) { p.Interval = "1w" }, ErrUnexpectedInterval},
+		{func(p *BTCBackfill) { p.To = p.From }, ErrUnexpectedTime},
+		{func(p *BTCBackfill) { p.Source = "wrong" }, ErrUnknownPriceSource},
+		{func(p *BTCBackfill) { p.Source = SourceKraken }, ErrNoHistory},
+	}
+	for _, c := range cases {
+		params := valid
+		c.change(&params)
+		_, err := svc.BackfillBTC(context.Background(), params)
+		require.ErrorIs(t, err, c.err)
+	}
+	err = svc.StartBackfillBTC(BackfillParams{Symbol: models.SymbolBTCUSDT, Source: SourceKuCoin, Interval: "1m"})
+	require.ErrorIs(t, err, ErrUnexpectedTime)
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"XTechProject/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CodeUSDT is the quote currency of the tracked pairs, it is priced as USD in fiat
+const CodeUSDT = "USDT"
+
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrUnexpectedAmount = errors.New("unexpected amount")
+	ErrNoRates          = errors.New("no rates at this time")
+)
+
+// ConvertParams are the request parameters of a conversion, At is RFC3339 or YYYY-MM-DD, now when it is empty
+type ConvertParams struct {
+	From   string
+	To     string
+	Amount string
+	At     string
+}
+
+// MatrixParams are the request parameters of a cross rate matrix, Symbols are comma separated
+type MatrixParams struct {
+	Base    string
+	Symbols string
+	At      string
+}
+
+type (
+	// Matrix holds the cross rates of Codes, Matrix[from][to] is the price of one from in to.
+	// The first code is Base.
+	Matrix struct {
+		Base   string                                `json:"base"`
+		At     time.Time                             `json:"at"`
+		Codes  []string                              `json:"codes"`
+		Matrix map[string]map[string]decimal.Decimal `json:"matrix"`
+		Rates  []UsedRate                            `json:"rates"`
+	}
+	// Conversion is Amount of From in To, Rate is the price of one From in To
+	Conversion struct {
+		From   string          `json:"from"`
+		To     string          `json:"to"`
+		Amount decimal.Decimal `json:"amount"`
+		Result decimal.Decimal `json:"result"`
+		Rate   decimal.Decimal `json:"rate"`
+		At     time.Time       `json:"at"`
+		Rates  []UsedRate      `json:"rates"`
+	}
+	// UsedRate is a stored rate the conversion was made with, Pair is like BTC/USDT or USD/RUB.
+	// Time is the time of a crypto record or the effective date of fiat rates.
+	UsedRate struct {
+		Pair   string          `json:"pair"`
+		Rate   decimal.Decimal `json:"rate"`
+		Source string          `json:"source"`
+		ID     int             `json:"id"`
+		Time   time.Time       `json:"time"`
+	}
+)
+
+// Convert prices params.Amount of From in To with the rates in effect at params.At.
+// Codes are USDT, the bases of the tracked pairs and the currencies of the primary fiat source.
+// Crypto is converted via USDT, fiat via the base of the fiat source, USDT is USD there.
+// Result and Rate are rounded by the precision of To.
+func (svc *ManagementService) Convert(ctx context.Context, params ConvertParams) (*Conversion, error) {
+	amount := decimal.NewFromInt(1)
+	if params.Amount != "" {
+		var err error
+		amount, err = decimal.NewFromString(params.Amount)
+		if err != nil || amount.IsNegative() {
+			return nil, fmt.Errorf("%w: %q", ErrUnexpectedAmount, params.Amount)
+		}
+	}
+	at, err := parseAt(params.At)
+	if err != nil {
+		return nil, err
+	}
+	c := &converter{svc: svc, at: at}
+	from, to := strings.ToUpper(strings.TrimSpace(params.From)), strings.ToUpper(strings.TrimSpace(params.To))
+	fromPrice, toPrice, err := c.prices(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	// multiplying first keeps the result exact when the prices are
+	result := amount.Mul(fromPrice).Div(toPrice)
+	return &Conversion{
+		From:   from,
+		To:     to,
+		Amount: amount,
+		Result: svc.precision.Round(to, c.isCrypto(to), result),
+		Rate:   svc.precision.Round(to, c.isCrypto(to), fromPrice.Div(toPrice)),
+		At:     at,
+		Rates:  c.used,
+	}, nil
+}
+
+// Matrix returns the cross rates of the base and the symbols in effect at params.At.
+// Without symbols all currencies of the primary fiat source, USDT and the bases of the tracked pairs are used.
+// Every cell is rounded by the precision of its column currency.
+func (svc *ManagementService) Matrix(ctx context.Context, params MatrixParams) (*Matrix, error) {
+	at, err := parseAt(params.At)
+	if err != nil {
+		return nil, err
+	}
+	c := &converter{svc: svc, at: at}
+	base := strings.ToUpper(strings.TrimSpace(params.Base))
+	if base == "" {
+		base = models.CharCodeUSD
+	}
+	if err := c.loadFiat(ctx); err != nil {
+		return nil, err
+	}
+	codes := []string{base}
+	seen := map[string]bool{base: true}
+	for _, code := range matrixSymbols(params.Symbols, c) {
+		if !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+	// every code is priced once in the fiat base, the cross rates are their ratios
+	prices := make(map[string]decimal.Decimal, len(codes))
+	for _, code := range codes {
+		if prices[code], err = c.inFiatBase(ctx, code, c.isCrypto(code)); err != nil {
+			return nil, err
+		}
+	}
+	matrix := make(map[string]map[string]decimal.Decimal, len(codes))
+	for _, from := range codes {
+		row := make(map[string]decimal.Decimal, len(codes))
+		for _, to := range codes {
+			row[to] = svc.precision.Round(to, c.isCrypto(to), prices[from].Div(prices[to]))
+		}
+		matrix[from] = row
+	}
+	return &Matrix{Base: base, At: at, Codes: codes, Matrix: matrix, Rates: c.used}, nil
+}
+
+// matrixSymbols splits the comma separated symbols, all known codes are returned for empty symbols
+func matrixSymbols(symbols string, c *converter) []string {
+	var codes []string
+	for _, code := range strings.Split(symbols, ",") {
+		if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) != 0 {
+		return codes
+	}
+	codes = append(codes, c.fiat.Base)
+	for code := range c.currencies {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes[1:])
+	codes = append(codes, CodeUSDT)
+	for _, symbol := range c.svc.symbols {
+		if code, quote, err := splitSymbol(symbol); err == nil && quote == CodeUSDT {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// parseAt parses the time of a conversion, it is now when value is empty
+func parseAt(value string) (time.Time, error) {
+	at, err := parseTime(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if at == nil {
+		return time.Now().UTC(), nil
+	}
+	return *at, nil
+}
+
+// converter looks up every rate once and keeps the rates it used
+type converter struct {
+	svc  *ManagementService
+	at   time.Time
+	fiat *models.Fiat
+	// currencies of fiat by char code
+	currencies map[string]models.Currency
+	used       []UsedRate
+}
+
+// prices returns the prices of from and to in a common currency, USDT when both are crypto
+func (c *converter) prices(ctx context.Context, from, to string) (decimal.Decimal, decimal.Decimal, error) {
+	for _, code := range []string{from, to} {
+		if code == "" {
+			return decimal.Zero, decimal.Zero, fmt.Errorf("%w: from and to are required", ErrUnknownCurrency)
+		}
+	}
+	fromCrypto, toCrypto := c.isCrypto(from), c.isCrypto(to)
+	price := c.inFiatBase
+	if fromCrypto && toCrypto {
+		price = func(ctx context.Context, code string, _ bool) (decimal.Decimal, error) { return c.inUSDT(ctx, code) }
+	}
+	fromPrice, err := price(ctx, from, fromCrypto)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+	toPrice, err := price(ctx, to, toCrypto)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+	return fromPrice, toPrice, nil
+}
+
+// isCrypto is true for USDT and the bases of the tracked pairs
+func (c *converter) isCrypto(code string) bool {
+	return code == CodeUSDT || c.svc.CheckSymbol(code+"-"+CodeUSDT) == nil
+}
+
+// inUSDT returns the price of the crypto code in USDT from its last record at c.at
+func (c *converter) inUSDT(ctx context.Context, code string) (decimal.Decimal, error) {
+	if code == CodeUSDT {
+		return decimal.NewFromInt(1), nil
+	}
+	symbol := code + "-" + CodeUSDT
+	btc, err := c.svc.db.GetBTCAsOf(ctx, symbol, c.at)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !btc.InUSDT.IsPositive()) {
+		return decimal.Zero, fmt.Errorf("%w: %s", ErrNoRates, symbol)
+	}
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("error in GetBTCAsOf: %w", err)
+	}
+	c.use(UsedRate{Pair: code + "/" + CodeUSDT, Rate: btc.InUSDT, Source: "quotes", ID: btc.ID, Time: *btc.CreatedAt})
+	return btc.InUSDT, nil
+}
+
+// inFiatBase returns the price of code in the base of the primary fiat source
+func (c *converter) inFiatBase(ctx context.Context, code string, crypto bool) (decimal.Decimal, error) {
+	if err := c.loadFiat(ctx); err != nil {
+		return decimal.Zero, err
+	}
+	if crypto {
+		price, err := c.inUSDT(ctx, code)
+		if err != nil {
+			return decimal.Zero, err
+		}
+		c.useFiat(models.CharCodeUSD, c.fiat.USDRUB)
+		return price.Mul(c.fiat.USDRUB), nil
+	}
+	if code == c.fiat.Base {
+		return decimal.NewFromInt(1), nil
+	}
+	cur, ok := c.currencies[code]
+	if !ok || !cur.Val.IsPositive() || cur.Nominal <= 0 {
+		return decimal.Zero, fmt.Errorf("%w: %s", ErrUnknownCurrency, code)
+	}
+	price := cur.UnitPrice()
+	c.useFiat(code, price)
+	return price, nil
+}
+
+// loadFiat reads the rates of the primary source that were in effect at c.at
+func (c *converter) loadFiat(ctx context.Context) error {
+	if c.fiat != nil {
+		return nil
+	}
+	source := c.svc.primaryFiatSource()
+	fiat, err := c.svc.db.GetFiatAsOf(ctx, source, fiatDate(source, c.at))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s fiat", ErrNoRates, source)
+	}
+	if err != nil {
+		return fmt.Errorf("error in GetFiatAsOf: %w", err)
+	}
+	if !fiat.USDRUB.IsPositive() {
+		return fmt.Errorf("%w: %s fiat without USD", ErrNoRates, source)
+	}
+	var currencies []models.Currency
+	if err := json.Unmarshal(fiat.Currencies, &currencies); err != nil {
+		return fmt.Errorf("error in json.Unmarshal: %w", err)
+	}
+	c.fiat = fiat
+	c.currencies = make(map[string]models.Currency, len(currencies))
+	for _, cur := range currencies {
+		c.currencies[cur.CharCode] = cur
+	}
+	return nil
+}
+
+func (c *converter) useFiat(code string, rate decimal.Decimal) {
+	rateTime := c.fiat.EffectiveDate
+	if rateTime == nil {
+		rateTime = c.fiat.CreatedAt
+	}
+	used := UsedRate{Pair: code + "/" + c.fiat.Base, Rate: rate, Source: c.fiat.Source, ID: c.fiat.ID}
+	if rateTime != nil {
+		used.Time = *rateTime
+	}
+	c.use(used)
+}
+
+// use keeps the rate once, the same pair can price both sides
+func (c *converter) use(rate UsedRate) {
+	for _, u := range c.used {
+		if u.Pair == rate.Pair {
+			return
+		}
+	}
+	c.used = append(c.used, rate)
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"XTechProject/cmd/config"
+	"XTechProject/internal/models"
+	mock_repository "XTechProject/internal/repository/mocks"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newConvertFiat(t *testing.T) *models.Fiat {
+	date := time.Date(2023, 12, 30, 0, 0, 0, 0, time.UTC)
+	currencies, err := json.Marshal([]models.Currency{
+		{CharCode: "USD", Nominal: 1, Val: decimal.NewFromInt(90)},
+		{CharCode: "EUR", Nominal: 1, Val: decimal.NewFromInt(100)},
+		{CharCode: "JPY", Nominal: 100, Val: decimal.NewFromInt(60)},
+	})
+	require.NoError(t, err)
+	return &models.Fiat{ID: 7, Source: FiatSourceCBR, Base: "RUB", EffectiveDate: &date, USDRUB: decimal.NewFromInt(90), Currencies: currencies}
+}
+
+func TestConvert(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	cfg, err := config.New()
+	require.NoError(t, err)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	createdAt := at.Add(-5 * time.Second)
+	btc := &models.BTC{ID: 3, Symbol: models.SymbolBTCUSDT, InUSDT: decimal.NewFromInt(45000), CreatedAt: &createdAt}
+	fiat := newConvertFiat(t)
+	// it is already January 1 in Moscow, the rates of December 30 are still in effect
+	repo.EXPECT().GetFiatAsOf(gomock.Any(), FiatSourceCBR, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)).
+		Return(fiat, nil).Times(1)
+	repo.EXPECT().GetBTCAsOf(gomock.Any(), models.SymbolBTCUSDT, at).Return(btc, nil).Times(1)
+	conversion, err := srv.Convert(context.Background(), ConvertParams{From: "eur", To: "BTC", Amount: "4050", At: "2024-01-01T00:00:00Z"})
+	require.NoError(t, err)
+	require.Equal(t, "EUR", conversion.From)
+	require.Equal(t, "BTC", conversion.To)
+	// the result is exact with the precision of BTC
+	requireDecimal(t, "0.1", conversion.Result)
+	// the rate is rounded like the result, 100/(45000*90) = 0.0000246913...
+	requireDecimal(t, "0.00002469", conversion.Rate)
+	require.Equal(t, []UsedRate{
+		{Pair: "EUR/RUB", Rate: decimal.NewFromInt(100), Source: FiatSourceCBR, ID: 7, Time: *fiat.EffectiveDate},
+		{Pair: "BTC/USDT", Rate: decimal.NewFromInt(45000), Source: "quotes", ID: 3, Time: createdAt},
+		{Pair: "USD/RUB", Rate: decimal.NewFromInt(90), Source: FiatSourceCBR, ID: 7, Time: *fiat.EffectiveDate},
+	}, conversion.Rates)
+
+	// fiat with a nominal, the base is priced 1
+	repo.EXPECT().GetFiatAsOf(gomock.Any(), FiatSourceCBR, gomock.Any()).Return(fiat, nil).Times(1)
+	conversion, err = srv.Convert(context.Background(), ConvertParams{From: "JPY", To: "RUB", Amount: "1000"})
+	require.NoError(t, err)
+	requireDecimal(t, "600", conversion.Result)
+	require.Len(t, conversion.Rates, 1)
+
+	// crypto to USDT doesn't need fiat rates
+	repo.EXPECT().GetBTCAsOf(gomock.Any(), models.SymbolBTCUSDT, gomock.Any()).Return(btc, nil).Times(1)
+	conversion, err = srv.Convert(context.Background(), ConvertParams{From: "BTC", To: "USDT"})
+	require.NoError(t, err)
+	requireDecimal(t, "1", conversion.Amount)
+	requireDecimal(t, "45000", conversion.Result)
+
+	// the result is rounded by the precision of to
+	repo.EXPECT().GetFiatAsOf(gomock.Any(), FiatSourceCBR, gomock.Any()).Return(fiat, nil).Times(1)
+	conversion, err = srv.Convert(context.Background(), ConvertParams{From: "RUB", To: "EUR", Amount: "1000.5"})
+	require.NoError(t, err)
+	requireDecimal(t, "10.01", conversion.Result)
+}
+
+func TestConvertError(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	cfg, err := config.New()
+	require.NoError(t, err)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+
+	_, err = srv.Convert(context.Background(), ConvertParams{From: "EUR", To: "RUB", Amount: "-1"})
+	require.ErrorIs(t, err, ErrUnexpectedAmount)
+	_, err = srv.Convert(context.Background(), ConvertParams{From: "EUR", To: "RUB", At: "yesterday"})
+	require.ErrorIs(t, err, ErrUnexpectedTime)
+	_, err = srv.Convert(context.Background(), ConvertParams{From: "EUR"})
+	require.ErrorIs(t, err, ErrUnknownCurrency)
+
+	repo.EXPECT().GetFiatAsOf(gomock.Any(), FiatSourceCBR, gomock.Any()).Return(newConvertFiat(t), nil).Times(1)
+	_, err = srv.Convert(context.Background(), ConvertParams{From: "XYZ", To: "RUB"})
+	require.ErrorIs(t, err, ErrUnknownCurrency)
+
+	repo.EXPECT().GetFiatAsOf(gomock.Any(), FiatSourceCBR, gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+	_, err = srv.Convert(context.Background(), ConvertParams{From: "EUR", To: "RUB", At: "2000-01-01"})
+	require.ErrorIs(t, err, ErrNoRates)
+}
+
+func TestMatrix(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	cfg, err := config.New()
+	require.NoError(t, err)
+	cfg.Precision.Currencies = map[string]int32{"JPY": 0}
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	btc := &models.BTC{ID: 3, Symbol: models.SymbolBTCUSDT, InUSDT: decimal.NewFromInt(45000), CreatedAt: &createdAt}
+
+	repo.EXPECT().GetFiatAsOf(gomock.Any(), FiatSourceCBR, gomock.Any()).Return(newConvertFiat(t), nil).Times(1)
+	repo.EXPECT().GetBTCAsOf(gomock.Any(), models.SymbolBTCUSDT, gomock.Any()).Return(btc, nil).Times(1)
+	matrix, err := srv.Matrix(context.Background(), MatrixParams{Base: "usd", Symbols: "EUR, JPY,BTC,USD"})
+	require.NoError(t, err)
+	require.Equal(t, "USD", matrix.Base)
+	require.Equal(t, []string{"USD", "EUR", "JPY", "BTC"}, matrix.Codes)
+	// 100 JPY cost 60 RUB, every cell is rounded by the precision of its column currency
+	requireDecimal(t, "167", matrix.Matrix["EUR"]["JPY"])
+	requireDecimal(t, "0.01", matrix.Matrix["JPY"]["USD"])
+	requireDecimal(t, "45000", matrix.Matrix["BTC"]["USD"])
+	requireDecimal(t, "0.00002222", matrix.Matrix["USD"]["BTC"])
+	requireDecimal(t, "1", matrix.Matrix["EUR"]["EUR"])
+	for _, from := range matrix.Codes {
+		require.Len(t, matrix.Matrix[from], len(matrix.Codes))
+	}
+
+	// all known codes without symbols
+	repo.EXPECT().GetFiatAsOf(gomock.Any(), FiatSourceCBR, gomock.Any()).Return(newConvertFiat(t), nil).Times(1)
+	repo.EXPECT().GetBTCAsOf(gomock.Any(), models.SymbolBTCUSDT, gomock.Any()).Return(btc, nil).Times(1)
+	matrix, err = srv.Matrix(context.Background(), MatrixParams{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"USD", "RUB", "EUR", "JPY", "USDT", "BTC"}, matrix.Codes)
+	requireDecimal(t, "1", matrix.Matrix["USDT"]["USD"])
+
+	repo.EXPECT().GetFiatAsOf(gomock.Any(), FiatSourceCBR, gomock.Any()).Return(newConvertFiat(t), nil).Times(1)
+	_, err = srv.Matrix(context.Background(), MatrixParams{Base: "USD", Symbols: "XYZ"})
+	require.ErrorIs(t, err, ErrUnknownCurrency)
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// UnknownCurrenciesError is returned for currency codes the service has no rates for, it is ErrUnknownCurrency
+type UnknownCurrenciesError struct {
+	Codes []string
+}
+
+func (e *UnknownCurrenciesError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrUnknownCurrency, strings.Join(e.Codes, ","))
+}
+
+func (e *UnknownCurrenciesError) Unwrap() error {
+	return ErrUnknownCurrency
+}
+
+// currencyCodes splits the comma separated codes of a filter, nil is returned for empty symbols.
+// Codes that are neither stored currencies nor fiat bases are an UnknownCurrenciesError.
+func (svc *ManagementService) currencyCodes(ctx context.Context, symbols string) ([]string, error) {
+	var codes []string
+	seen := make(map[string]bool)
+	for _, code := range strings.Split(symbols, ",") {
+		if code = strings.ToUpper(strings.TrimSpace(code)); code != "" && !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	unknown, err := svc.db.UnknownCurrencies(ctx, codes)
+	if err != nil {
+		return nil, fmt.Errorf("error in UnknownCurrencies: %w", err)
+	}
+	if len(unknown) != 0 {
+		return nil, &UnknownCurrenciesError{Codes: unknown}
+	}
+	return codes, nil
+}
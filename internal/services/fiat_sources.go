@@ -0,0 +1,320 @@
+package services
+
+import (
+	"XTechProject/cmd/config"
+	"XTechProject/internal/fetch"
+	"XTechProject/internal/models"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	FiatSourceCBR  = "cbr"
+	FiatSourceECB  = "ecb"
+	FiatSourceJSON = "json"
+)
+
+var ErrUnknownFiatSource = errors.New("unknown fiat source")
+
+// fiatTimezones are the timezones of the effective dates of the sources, UTC is used for the others
+var fiatTimezones = map[string]string{
+	FiatSourceCBR: "Europe/Moscow",
+	FiatSourceECB: "Europe/Berlin",
+}
+
+// fiatLocation returns the timezone of the effective dates of the source
+func fiatLocation(source string) *time.Location {
+	if name, ok := fiatTimezones[source]; ok {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// fiatDate returns the date of t where the source sets its rates, as UTC midnight like the effective dates
+func fiatDate(source string, t time.Time) time.Time {
+	return truncateDay(t.In(fiatLocation(source)))
+}
+
+// HistoricalFiatSource also returns the rates of past dates
+type HistoricalFiatSource interface {
+	FiatSource
+	GetFiatOn(ctx context.Context, date time.Time) (*models.Fiat, error)
+}
+
+// FiatSource returns a snapshot of currency rates, every Currency.Val is the price of Nominal units in Base()
+type FiatSource interface {
+	Name() string
+	Base() string
+	GetFiat(ctx context.Context) (*models.Fiat, error)
+	Status() fetch.Status
+}
+
+func NewFiatSource(name string, cfg *config.Config) (FiatSource, error) {
+	switch name {
+	case FiatSourceCBR:
+		return &CBRSource{upstream: newUpstream(name, cfg), link: cfg.URLs.Fiat}, nil
+	case FiatSourceECB:
+		return &ECBSource{upstream: newUpstream(name, cfg), link: cfg.URLs.ECB}, nil
+	case FiatSourceJSON:
+		return &JSONFiatSource{upstream: newUpstream(name, cfg), link: cfg.URLs.FiatJSON, base: strings.ToUpper(cfg.Fiat.JSONBase)}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFiatSource, name)
+	}
+}
+
+// NewFiatSources returns the configured sources, the first one is the primary source served by the API
+func NewFiatSources(cfg *config.Config) ([]FiatSource, error) {
+	if len(cfg.Fiat.Sources) == 0 {
+		return nil, fmt.Errorf("%w: no sources configured", ErrUnknownFiatSource)
+	}
+	sources := make([]FiatSource, 0, len(cfg.Fiat.Sources))
+	for _, name := range cfg.Fiat.Sources {
+		source, err := NewFiatSource(strings.TrimSpace(name), cfg)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// newFiatModel builds a latest snapshot from currencies priced in base that are effective on date
+func newFiatModel(source, base string, date *time.Time, cur []models.Currency) (*models.Fiat, error) {
+	if len(cur) == 0 {
+		return nil, ErrEmptyValuteSlice
+	}
+	var usd decimal.Decimal
+	if base == models.CharCodeUSD {
+		usd = decimal.NewFromInt(1)
+	}
+	for _, c := range cur {
+		if c.CharCode == models.CharCodeUSD && c.Nominal > 0 {
+			usd = c.UnitPrice()
+		}
+	}
+	if usd.IsZero() {
+		return nil, ErrUSDNotFound
+	}
+	bts, err := json.Marshal(cur)
+	if err != nil {
+		return nil, err
+	}
+	return &models.Fiat{
+		Source:        source,
+		Base:          base,
+		Latest:        true,
+		EffectiveDate: date,
+		USDRUB:        usd,
+		Currencies:    bts,
+	}, nil
+}
+
+// parseEffectiveDate parses the date of the rates, sources without a date get today in UTC
+func parseEffectiveDate(layout, value string) (*time.Time, error) {
+	if value == "" {
+		today := truncateDay(time.Now().UTC())
+		return &today, nil
+	}
+	date, err := time.Parse(layout, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: date %q", ErrUnexpectedResponse, value)
+	}
+	return &date, nil
+}
+
+// invertRates turns "units of currency for one base" rates into Currency values priced in base,
+// the values are rounded to decimal.DivisionPrecision digits
+func invertRates(rates map[string]decimal.Decimal) ([]models.Currency, error) {
+	cur := make([]models.Currency, 0, len(rates))
+	one := decimal.NewFromInt(1)
+	for code, rate := range rates {
+		if !rate.IsPositive() {
+			return nil, fmt.Errorf("unexpected rate %s for %s", rate, code)
+		}
+		cur = append(cur, models.Currency{
+			Name:     code,
+			Nominal:  1,
+			CharCode: code,
+			Val:      one.Div(rate),
+		})
+	}
+	sort.Slice(cur, func(i, j int) bool { return cur[i].CharCode < cur[j].CharCode })
+	return cur, nil
+}
+
+type (
+	CBRSource struct {
+		upstream
+		link string
+	}
+	ValCurs struct {
+		XMLName xml.Name `xml:"ValCurs"`
+		Date    string   `xml:"Date,attr"`
+		Name    string   `xml:"name,attr"`
+		Valutes []Valute `xml:"Valute"`
+	}
+	Valute struct {
+		ID       string `xml:"ID,attr"`
+		NumCode  string `xml:"NumCode"`
+		CharCode string `xml:"CharCode"`
+		Nominal  string `xml:"Nominal"`
+		Name     string `xml:"Name"`
+		Value    string `xml:"Value"`
+	}
+)
+
+func (s *CBRSource) Name() string { return FiatSourceCBR }
+
+func (s *CBRSource) Base() string { return "RUB" }
+
+func (s *CBRSource) GetFiat(ctx context.Context) (*models.Fiat, error) {
+	var val ValCurs
+	if err := getXML(ctx, s.client, s.link, &val); err != nil {
+		return nil, err
+	}
+	return s.newFiat(val)
+}
+
+// GetFiatOn returns the rates CBR set on date, CreatedAt is stamped with their effective date.
+// On weekends and holidays it is the last working day before date.
+func (s *CBRSource) GetFiatOn(ctx context.Context, date time.Time) (*models.Fiat, error) {
+	link, err := url.Parse(s.link)
+	if err != nil {
+		return nil, err
+	}
+	query := link.Query()
+	query.Set("date_req", date.Format("02/01/2006"))
+	link.RawQuery = query.Encode()
+	var val ValCurs
+	if err := getXML(ctx, s.client, link.String(), &val); err != nil {
+		return nil, err
+	}
+	fiat, err := s.newFiat(val)
+	if err != nil {
+		return nil, err
+	}
+	fiat.Latest = false
+	fiat.CreatedAt = fiat.EffectiveDate
+	return fiat, nil
+}
+
+// newFiat keeps the date of ValCurs, after 15:30 MSK CBR already publishes the rates of the next working day
+func (s *CBRSource) newFiat(val ValCurs) (*models.Fiat, error) {
+	if val.Date == "" {
+		return nil, fmt.Errorf("%w: cbr date is empty", ErrUnexpectedResponse)
+	}
+	date, err := parseEffectiveDate("02.01.2006", val.Date)
+	if err != nil {
+		return nil, err
+	}
+	currencies, usdrub, err := serializeFiatCurrenciesData(val.Valutes)
+	if err != nil {
+		return nil, fmt.Errorf("error in serializeFiatCurrenciesData, err: %w", err)
+	}
+	return &models.Fiat{
+		Source:        FiatSourceCBR,
+		Base:          s.Base(),
+		Latest:        true,
+		EffectiveDate: date,
+		USDRUB:        usdrub,
+		Currencies:    currencies,
+	}, nil
+}
+
+type (
+	ECBSource struct {
+		upstream
+		link string
+	}
+	// ECBEnvelope is the eurofxref XML, rates are units of currency for one EUR
+	ECBEnvelope struct {
+		XMLName xml.Name `xml:"Envelope"`
+		Cube    struct {
+			Cube struct {
+				Time  string `xml:"time,attr"`
+				Rates []struct {
+					Currency string `xml:"currency,attr"`
+					Rate     string `xml:"rate,attr"`
+				} `xml:"Cube"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	}
+)
+
+func (s *ECBSource) Name() string { return FiatSourceECB }
+
+func (s *ECBSource) Base() string { return "EUR" }
+
+func (s *ECBSource) GetFiat(ctx context.Context) (*models.Fiat, error) {
+	var env ECBEnvelope
+	if err := getXML(ctx, s.client, s.link, &env); err != nil {
+		return nil, err
+	}
+	date, err := parseEffectiveDate("2006-01-02", env.Cube.Cube.Time)
+	if err != nil {
+		return nil, err
+	}
+	rates := make(map[string]decimal.Decimal, len(env.Cube.Cube.Rates))
+	for _, r := range env.Cube.Cube.Rates {
+		rate, err := decimal.NewFromString(r.Rate)
+		if err != nil {
+			return nil, err
+		}
+		rates[r.Currency] = rate
+	}
+	cur, err := invertRates(rates)
+	if err != nil {
+		return nil, fmt.Errorf("error in invertRates, err: %w", err)
+	}
+	return newFiatModel(FiatSourceECB, s.Base(), date, cur)
+}
+
+type (
+	// JSONFiatSource reads the common {"base": "USD", "rates": {"EUR": 0.9}} format,
+	// rates are units of currency for one base
+	JSONFiatSource struct {
+		upstream
+		link string
+		base string
+	}
+	JSONFiatResponse struct {
+		Base  string                     `json:"base"`
+		Date  string                     `json:"date"`
+		Rates map[string]decimal.Decimal `json:"rates"`
+	}
+)
+
+func (s *JSONFiatSource) Name() string { return FiatSourceJSON }
+
+func (s *JSONFiatSource) Base() string { return s.base }
+
+func (s *JSONFiatSource) GetFiat(ctx context.Context) (*models.Fiat, error) {
+	var r JSONFiatResponse
+	if err := getJSON(ctx, s.client, s.link, &r); err != nil {
+		return nil, err
+	}
+	if r.Base != "" && !strings.EqualFold(r.Base, s.base) {
+		return nil, fmt.Errorf("%w: base %s, expected %s", ErrUnexpectedResponse, r.Base, s.base)
+	}
+	date, err := parseEffectiveDate("2006-01-02", r.Date)
+	if err != nil {
+		return nil, err
+	}
+	// the base itself is often listed with rate 1
+	delete(r.Rates, s.base)
+	cur, err := invertRates(r.Rates)
+	if err != nil {
+		return nil, fmt.Errorf("error in invertRates, err: %w", err)
+	}
+	return newFiatModel(FiatSourceJSON, s.base, date, cur)
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"XTechProject/cmd/config"
+	"XTechProject/internal/models"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestFiatProvider(t *testing.T, body string) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestCBRSource(t *testing.T) {
+	body := `<?xml version="1.0" encoding="windows-1251"?>
+<ValCurs Date="21.12.2022" name="Foreign Currency Market">
+	<Valute ID="R01235"><NumCode>840</NumCode><CharCode>USD</CharCode><Nominal>1</Nominal><Name>USD</Name><Value>68,6644</Value></Valute>
+	<Valute ID="R01820"><NumCode>392</NumCode><CharCode>JPY</CharCode><Nominal>100</Nominal><Name>JPY</Name><Value>51,9524</Value></Valute>
+</ValCurs>`
+	source := &CBRSource{link: newTestFiatProvider(t, body)}
+	fiat, err := source.GetFiat(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, FiatSourceCBR, fiat.Source)
+	require.Equal(t, "RUB", fiat.Base)
+	requireDecimal(t, "68.6644", fiat.USDRUB)
+	require.Equal(t, time.Date(2022, 12, 21, 0, 0, 0, 0, time.UTC), *fiat.EffectiveDate)
+	var cur []models.Currency
+	require.NoError(t, json.Unmarshal(fiat.Currencies, &cur))
+	require.Len(t, cur, 2)
+}
+
+func TestECBSource(t *testing.T) {
+	body := `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2022-12-21">
+			<Cube currency="USD" rate="1.25"/>
+			<Cube currency="JPY" rate="140"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+	source := &ECBSource{link: newTestFiatProvider(t, body)}
+	fiat, err := source.GetFiat(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, FiatSourceECB, fiat.Source)
+	require.Equal(t, "EUR", fiat.Base)
+	requireDecimal(t, "0.8", fiat.USDRUB)
+	require.Equal(t, time.Date(2022, 12, 21, 0, 0, 0, 0, time.UTC), *fiat.EffectiveDate)
+	var cur []models.Currency
+	require.NoError(t, json.Unmarshal(fiat.Currencies, &cur))
+	require.Len(t, cur, 2)
+	require.Equal(t, models.Currency{Name: "JPY", Nominal: 1, CharCode: "JPY", Val: cur[0].Val}, cur[0])
+	requireDecimal(t, "0.0071428571428571", cur[0].Val)
+	require.Equal(t, models.Currency{Name: "USD", Nominal: 1, CharCode: "USD", Val: cur[1].Val}, cur[1])
+	requireDecimal(t, "0.8", cur[1].Val)
+}
+
+func TestJSONFiatSource(t *testing.T) {
+	body := `{"base":"USD","date":"2022-12-21","rates":{"USD":1,"EUR":0.8,"RUB":68.6644}}`
+	source := &JSONFiatSource{link: newTestFiatProvider(t, body), base: "USD"}
+	fiat, err := source.GetFiat(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, FiatSourceJSON, fiat.Source)
+	require.Equal(t, "USD", fiat.Base)
+	requireDecimal(t, "1", fiat.USDRUB)
+	require.Equal(t, time.Date(2022, 12, 21, 0, 0, 0, 0, time.UTC), *fiat.EffectiveDate)
+	var cur []models.Currency
+	require.NoError(t, json.Unmarshal(fiat.Currencies, &cur))
+	require.Len(t, cur, 2)
+	require.Equal(t, "EUR", cur[0].CharCode)
+	requireDecimal(t, "1.25", cur[0].Val)
+}
+
+func TestFiatSourcesError(t *testing.T) {
+	cases := []struct {
+		name   string
+		source func(link string) FiatSource
+		body   string
+		expErr error
+	}{
+		{
+			name:   "json with other base",
+			source: func(link string) FiatSource { return &JSONFiatSource{link: link, base: "USD"} },
+			body:   `{"base":"EUR","rates":{"USD":1.25}}`,
+			expErr: ErrUnexpectedResponse,
+		},
+		{
+			name:   "json without rates",
+			source: func(link string) FiatSource { return &JSONFiatSource{link: link, base: "USD"} },
+			body:   `{"base":"USD","rates":{}}`,
+			expErr: ErrEmptyValuteSlice,
+		},
+		{
+			name:   "ecb without USD",
+			source: func(link string) FiatSource { return &ECBSource{link: link} },
+			body:   `<Envelope><Cube><Cube time="2022-12-21"><Cube currency="JPY" rate="140"/></Cube></Cube></Envelope>`,
+			expErr: ErrUSDNotFound,
+		},
+		{
+			name:   "cbr without valutes",
+			source: func(link string) FiatSource { return &CBRSource{link: link} },
+			body:   `<ValCurs Date="21.12.2022"></ValCurs>`,
+			expErr: ErrEmptyValuteSlice,
+		},
+		{
+			name:   "cbr without date",
+			source: func(link string) FiatSource { return &CBRSource{link: link} },
+			body:   `<ValCurs><Valute ID="R01235"><CharCode>USD</CharCode><Nominal>1</Nominal><Value>68,6644</Value></Valute></ValCurs>`,
+			expErr: ErrUnexpectedResponse,
+		},
+		{
+			name:   "ecb with a wrong date",
+			source: func(link string) FiatSource { return &ECBSource{link: link} },
+			body:   `<Envelope><Cube><Cube time="21.12.2022"><Cube currency="USD" rate="1.25"/></Cube></Cube></Envelope>`,
+			expErr: ErrUnexpectedResponse,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := c.source(newTestFiatProvider(t, c.body)).GetFiat(context.Background())
+			require.ErrorIs(t, err, c.expErr)
+		})
+	}
+}
+
+func TestNewFiatSource(t *testing.T) {
+	cfg, err := config.New()
+	require.NoError(t, err)
+	for _, name := range []string{FiatSourceCBR, FiatSourceECB, FiatSourceJSON} {
+		source, err := NewFiatSource(name, cfg)
+		require.NoError(t, err)
+		require.Equal(t, name, source.Name())
+	}
+	_, err = NewFiatSource("wrong", cfg)
+	require.ErrorIs(t, err, ErrUnknownFiatSource)
+}
+
+func TestCBRSourceGetFiatOn(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "05/03/2023", r.URL.Query().Get("date_req"))
+		// Sunday has the rates set on Saturday
+		_, _ = w.Write([]byte(`<ValCurs Date="04.03.2023">
+	<Valute ID="R01235"><NumCode>840</NumCode><CharCode>USD</CharCode><Nominal>1</Nominal><Name>USD</Name><Value>75,4323</Value></Valute>
+</ValCurs>`))
+	}))
+	defer srv.Close()
+	source := &CBRSource{link: srv.URL + "/scripts/XML_daily.asp"}
+	fiat, err := source.GetFiatOn(context.Background(), time.Date(2023, 3, 5, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.False(t, fiat.Latest)
+	requireDecimal(t, "75.4323", fiat.USDRUB)
+	require.Equal(t, time.Date(2023, 3, 4, 0, 0, 0, 0, time.UTC), *fiat.CreatedAt)
+	require.Equal(t, time.Date(2023, 3, 4, 0, 0, 0, 0, time.UTC), *fiat.EffectiveDate)
+}
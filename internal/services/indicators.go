@@ -0,0 +1,115 @@
+package services
+
+import (
+	"XTechProject/internal/analytics"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultIndicatorPeriod   = 20
+	defaultIndicatorInterval = "1h"
+)
+
+// candleSteps are the sizes of the candle intervals, the warmup of indicators is fetched before from
+var candleSteps = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+	"1w": 7 * 24 * time.Hour,
+}
+
+type (
+	// IndicatorParams are the request parameters of an indicator, Period is 20 and Interval is 1h by default
+	IndicatorParams struct {
+		Type     string
+		Period   int
+		Interval string
+		From     string
+		To       string
+	}
+	// IndicatorSeries is an indicator of the candle closes of Symbol
+	IndicatorSeries struct {
+		Symbol   string            `json:"symbol"`
+		Type     string            `json:"type"`
+		Period   int               `json:"period,omitempty"`
+		Interval string            `json:"interval"`
+		Points   []analytics.Point `json:"points"`
+	}
+)
+
+// GetIndicator computes the indicator over the closes of the stored candles of the pair from..to.
+// The candles it needs to warm up are read before from, moving averages are rounded like the quote currency.
+// Drawdown starts from the highest close before from, so moving the window doesn't change its values.
+func (svc *ManagementService) GetIndicator(ctx context.Context, symbol string, params IndicatorParams) (*IndicatorSeries, error) {
+	if params.Period == 0 {
+		params.Period = defaultIndicatorPeriod
+	}
+	if params.Interval == "" {
+		params.Interval = defaultIndicatorInterval
+	}
+	indicator, err := analytics.Get(params.Type, params.Period)
+	if err != nil {
+		return nil, err
+	}
+	pgInterval, err := serializeInterval(params.Interval)
+	if err != nil {
+		return nil, err
+	}
+	from, err := parseTime(params.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseTime(params.To)
+	if err != nil {
+		return nil, err
+	}
+	warmupFrom := from
+	if from != nil {
+		t := from.Add(-time.Duration(indicator.Warmup(params.Period)) * candleSteps[params.Interval])
+		warmupFrom = &t
+	}
+	candles, err := svc.db.GetCandles(ctx, symbol, pgInterval, warmupFrom, to)
+	if err != nil {
+		return nil, fmt.Errorf("error in GetCandles: %w", err)
+	}
+	points := make([]analytics.Point, 0, len(candles)+1)
+	if indicator.Peak && from != nil {
+		peak, err := svc.db.GetPeakClose(ctx, symbol, pgInterval, *from)
+		if err != nil {
+			return nil, fmt.Errorf("error in GetPeakClose: %w", err)
+		}
+		// the point before from sets the peak and is dropped from the series
+		if peak.Valid {
+			points = append(points, analytics.Point{Time: from.Add(-candleSteps[params.Interval]), Value: peak.Decimal})
+		}
+	}
+	for _, c := range candles {
+		points = append(points, analytics.Point{Time: *c.Time, Value: c.Close})
+	}
+	series := indicator.Compute(points, params.Period)
+	res := make([]analytics.Point, 0, len(series))
+	for _, p := range series {
+		if from != nil && p.Time.Before(*from) {
+			continue
+		}
+		if indicator.Price {
+			p.Value = svc.precision.Round(CodeUSDT, true, p.Value)
+		}
+		res = append(res, p)
+	}
+	period := params.Period
+	if indicator.MinPeriod == 0 {
+		period = 0
+	}
+	return &IndicatorSeries{
+		Symbol:   symbol,
+		Type:     strings.ToLower(params.Type),
+		Period:   period,
+		Interval: params.Interval,
+		Points:   res,
+	}, nil
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// klinesPerRequest fits the page limits of all kline sources
+const klinesPerRequest = 1000
+
+// klineIntervals are the kline sizes a backfill can use
+var klineIntervals = map[string]time.Duration{
+	"1m":  time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"1h":  time.Hour,
+	"1d":  24 * time.Hour,
+}
+
+type (
+	// KlineSource also returns past candles of a symbol
+	KlineSource interface {
+		PriceSource
+		// GetKlines returns the klines of interval that start from..to, oldest first
+		GetKlines(ctx context.Context, symbol, interval string, from, to time.Time) ([]Kline, error)
+	}
+	// Kline is an exchange candle that starts at Time, Close is kept as the exchange sends it
+	Kline struct {
+		Time  time.Time
+		Close string
+	}
+)
+
+type KuCoinCandlesResponse struct {
+	Code string `json:"code"`
+	// every candle is [time, open, close, high, low, volume, turnover], newest first
+	Data [][]string `json:"data"`
+}
+
+var kuCoinIntervals = map[string]string{"1m": "1min", "5m": "5min", "15m": "15min", "1h": "1hour", "1d": "1day"}
+
+func (s *KuCoinSource) GetKlines(ctx context.Context, symbol, interval string, from, to time.Time) ([]Kline, error) {
+	kind, ok := kuCoinIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedInterval, interval)
+	}
+	query := url.Values{}
+	query.Set("type", kind)
+	query.Set("symbol", symbol)
+	query.Set("startAt", strconv.FormatInt(from.Unix(), 10))
+	query.Set("endAt", strconv.FormatInt(to.Unix(), 10))
+	var r KuCoinCandlesResponse
+	if err := getJSON(ctx, s.client, s.baseURL+"/api/v1/market/candles?"+query.Encode(), &r); err != nil {
+		return nil, err
+	}
+	if r.Code != "200000" {
+		return nil, fmt.Errorf("%w: kucoin code %s", ErrUnexpectedResponse, r.Code)
+	}
+	klines := make([]Kline, 0, len(r.Data))
+	for i := len(r.Data) - 1; i >= 0; i-- {
+		candle := r.Data[i]
+		if len(candle) < 3 {
+			return nil, fmt.Errorf("%w: kucoin candle %v", ErrUnexpectedResponse, candle)
+		}
+		sec, err := strconv.ParseInt(candle[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: kucoin candle time %s", ErrUnexpectedResponse, candle[0])
+		}
+		klines = append(klines, Kline{Time: time.Unix(sec, 0).UTC(), Close: candle[2]})
+	}
+	return klinesBetween(klines, from, to), nil
+}
+
+// BinanceKlinesResponse is a list of [open time, open, high, low, close, volume, close time, ...]
+type BinanceKlinesResponse [][]json.RawMessage
+
+func (s *BinanceSource) GetKlines(ctx context.Context, symbol, interval string, from, to time.Time) ([]Kline, error) {
+	if _, ok := klineIntervals[interval]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedInterval, interval)
+	}
+	base, quote, err := splitSymbol(symbol)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	query.Set("symbol", base+quote)
+	query.Set("interval", interval)
+	query.Set("startTime", strconv.FormatInt(from.UnixMilli(), 10))
+	query.Set("endTime", strconv.FormatInt(to.UnixMilli()-1, 10))
+	query.Set("limit", strconv.Itoa(klinesPerRequest))
+	var r BinanceKlinesResponse
+	if err := getJSON(ctx, s.client, s.baseURL+"/api/v3/klines?"+query.Encode(), &r); err != nil {
+		return nil, err
+	}
+	klines := make([]Kline, 0, len(r))
+	for _, candle := range r {
+		var (
+			openTime int64
+			price    string
+		)
+		if len(candle) < 5 || json.Unmarshal(candle[0], &openTime) != nil || json.Unmarshal(candle[4], &price) != nil {
+			return nil, fmt.Errorf("%w: binance kline", ErrUnexpectedResponse)
+		}
+		klines = append(klines, Kline{Time: time.UnixMilli(openTime).UTC(), Close: price})
+	}
+	return klinesBetween(klines, from, to), nil
+}
+
+// klinesBetween drops the klines that don't start in [from, to), the exchanges include the edges differently
+func klinesBetween(klines []Kline, from, to time.Time) []Kline {
+	res := klines[:0]
+	for _, k := range klines {
+		if !k.Time.Before(from) && k.Time.Before(to) {
+			res = append(res, k)
+		}
+	}
+	return res
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestKlineSources(t *testing.T) {
+	from := time.Unix(1677628800, 0).UTC()
+	to := from.Add(3 * time.Minute)
+	cases := []struct {
+		name   string
+		source func(baseURL string) KlineSource
+		path   string
+		query  string
+		body   string
+	}{
+		{
+			name:   "kucoin",
+			source: func(baseURL string) KlineSource { return &KuCoinSource{baseURL: baseURL} },
+			path:   "/api/v1/market/candles",
+			query:  "endAt=1677628980&startAt=1677628800&symbol=BTC-USDT&type=1min",
+			// newest first, the kline at endAt is not in the range
+			body: `{"code":"200000","data":[
+				["1677628980","23150","23160","23170","23140","1","1"],
+				["1677628860","23140","23150","23160","23130","1","1"],
+				["1677628800","23130","23140","23150","23120","1","1"]]}`,
+		},
+		{
+			name:   "binance",
+			source: func(baseURL string) KlineSource { return &BinanceSource{baseURL: baseURL} },
+			path:   "/api/v3/klines",
+			query:  "endTime=1677628979999&interval=1m&limit=1000&startTime=1677628800000&symbol=BTCUSDT",
+			body: `[[1677628800000,"23130","23150","23120","23140","1",1677628859999,"1",1,"1","1","0"],
+				[1677628860000,"23140","23160","23130","23150","1",1677628919999,"1",1,"1","1","0"]]`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			source := c.source(newTestExchange(t, c.path, c.query, c.body))
+			klines, err := source.GetKlines(context.Background(), "BTC-USDT", "1m", from, to)
+			require.NoError(t, err)
+			require.Equal(t, []Kline{
+				{Time: from, Close: "23140"},
+				{Time: from.Add(time.Minute), Close: "23150"},
+			}, klines)
+		})
+	}
+}
+
+func TestKlineSourcesError(t *testing.T) {
+	from := time.Unix(1677628800, 0).UTC()
+	_, err := (&KuCoinSource{}).GetKlines(context.Background(), "BTC-USDT", "2m", from, from.Add(time.Hour))
+	require.ErrorIs(t, err, ErrUnexpectedInterval)
+	source := &KuCoinSource{baseURL: newTestExchange(t, "/api/v1/market/candles",
+		"endAt=1677632400&startAt=1677628800&symbol=BTC-USDT&type=1min", `{"code":"400100","msg":"error"}`)}
+	_, err = source.GetKlines(context.Background(), "BTC-USDT", "1m", from, from.Add(time.Hour))
+	require.ErrorIs(t, err, ErrUnexpectedResponse)
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"XTechProject/internal/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultPageSize is used when a cursor comes without limit
+const defaultPageSize = 100
+
+const (
+	// btcTime and fiatTime are the columns the history is filtered by and paged by in (column, id) order,
+	// fiat snapshots are dated by the day the source set the rates for, not by when they were stored
+	btcTime  = "created_at"
+	fiatTime = "effective_date"
+)
+
+var ErrUnexpectedCursor = errors.New("unexpected cursor")
+
+type (
+	// HistoryParams are the request parameters of history endpoints
+	HistoryParams struct {
+		Offset  int
+		Limit   int
+		OrderBy string
+		From    string
+		To      string
+		Cursor  string
+	}
+	// Page describes the returned history, Total counts all records in the time range
+	Page struct {
+		Total      int
+		NextCursor string
+		PrevCursor string
+	}
+	// cursor is the position of a page in (time, id) order, it is sent to clients as an opaque token
+	cursor struct {
+		Time     time.Time `json:"t"`
+		ID       int       `json:"id"`
+		Backward bool      `json:"b,omitempty"`
+	}
+	// pagination is how a history query is paged, limit is 0 for limit/offset pages without cursors
+	pagination struct {
+		limit  int
+		cursor *cursor
+	}
+)
+
+func encodeCursor(c cursor) string {
+	bts, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(bts)
+}
+
+func decodeCursor(token string) (*cursor, error) {
+	bts, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedCursor, err.Error())
+	}
+	var c cursor
+	if err := json.Unmarshal(bts, &c); err != nil || c.Time.IsZero() {
+		return nil, fmt.Errorf("%w: malformed token", ErrUnexpectedCursor)
+	}
+	return &c, nil
+}
+
+// newHistoryFilter validates the request parameters of history endpoints.
+// Pages ordered by timeColumn use keyset pagination unless an offset is given.
+func newHistoryFilter(params HistoryParams, timeColumn string) (*models.HistoryFilter, *pagination, error) {
+	orderBy, err := serializeOrderBy(params.OrderBy)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error in serializeOrderBy: %w", err)
+	}
+	field := strings.TrimPrefix(params.OrderBy, "-")
+	if field == fiatTime && timeColumn != fiatTime {
+		return nil, nil, fmt.Errorf("error in serializeOrderBy: %w", ErrUnexpectedOrderBy)
+	}
+	fromTime, err := parseTime(params.From)
+	if err != nil {
+		return nil, nil, err
+	}
+	toTime, err := parseTime(params.To)
+	if err != nil {
+		return nil, nil, err
+	}
+	filter := &models.HistoryFilter{
+		Limit:   params.Limit,
+		Offset:  params.Offset,
+		OrderBy: orderBy,
+		From:    fromTime,
+		To:      toTime,
+	}
+	var c *cursor
+	if params.Cursor != "" {
+		if c, err = decodeCursor(params.Cursor); err != nil {
+			return nil, nil, err
+		}
+		if params.Offset != 0 {
+			return nil, nil, fmt.Errorf("%w: cursor can't be used with offset", ErrUnexpectedCursor)
+		}
+	}
+	if field != "" && field != timeColumn {
+		if c != nil {
+			return nil, nil, fmt.Errorf("%w: cursor needs order by %s", ErrUnexpectedCursor, timeColumn)
+		}
+		return filter, &pagination{}, nil
+	}
+	desc := strings.HasPrefix(params.OrderBy, "-")
+	if c == nil && (params.Offset != 0 || params.Limit == 0) {
+		return filter, &pagination{}, nil
+	}
+	p := &pagination{limit: params.Limit, cursor: c}
+	if p.limit == 0 {
+		p.limit = defaultPageSize
+	}
+	// walking backward reads the rows in reversed order
+	reversed := desc
+	if c != nil && c.Backward {
+		reversed = !reversed
+	}
+	filter.OrderBy = fmt.Sprintf("ORDER BY %s, id", timeColumn)
+	if reversed {
+		filter.OrderBy = fmt.Sprintf("ORDER BY %s DESC, id DESC", timeColumn)
+	}
+	if c != nil {
+		key := &models.Keyset{Time: c.Time, ID: c.ID}
+		if reversed {
+			filter.Before = key
+		} else {
+			filter.After = key
+		}
+	}
+	// one more row tells if there is a next page
+	filter.Limit = p.limit + 1
+	return filter, p, nil
+}
+
+// paginate trims the rows to the page and returns its next and previous cursors
+func paginate[T any](rows []T, key func(T) models.Keyset, p *pagination) ([]T, string, string) {
+	if p.limit == 0 {
+		return rows, "", ""
+	}
+	more := len(rows) > p.limit
+	if more {
+		rows = rows[:p.limit]
+	}
+	backward := p.cursor != nil && p.cursor.Backward
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+	if len(rows) == 0 {
+		return rows, "", ""
+	}
+	var next, prev string
+	// a backward page always has the rows it came from after it
+	if more || backward {
+		last := key(rows[len(rows)-1])
+		next = encodeCursor(cursor{Time: last.Time, ID: last.ID})
+	}
+	if (more && backward) || (!backward && p.cursor != nil) {
+		first := key(rows[0])
+		prev = encodeCursor(cursor{Time: first.Time, ID: first.ID, Backward: true})
+	}
+	return rows, next, prev
+}
+
+func btcKeyset(btc models.BTC) models.Keyset {
+	return models.Keyset{Time: *btc.CreatedAt, ID: btc.ID}
+}
+
+func fiatKeyset(fiat models.Fiat) models.Keyset {
+	return models.Keyset{Time: *fiat.EffectiveDate, ID: fiat.ID}
+}
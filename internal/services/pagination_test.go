@@ -0,0 +1,131 @@
+package services
+
+import (
+	"XTechProject/internal/models"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+	"time"
+)
+
+// selectBTC does what the repository does with a filter ordered by created_at
+func selectBTC(rows []models.BTC, filter *models.HistoryFilter) []models.BTC {
+	less := func(a models.BTC, key *models.Keyset) bool {
+		return a.CreatedAt.Before(key.Time) || (a.CreatedAt.Equal(key.Time) && a.ID < key.ID)
+	}
+	var res []models.BTC
+	for _, r := range rows {
+		if filter.After != nil && (less(r, filter.After) || r.ID == filter.After.ID) {
+			continue
+		}
+		if filter.Before != nil && !less(r, filter.Before) {
+			continue
+		}
+		res = append(res, r)
+	}
+	if filter.OrderBy == "ORDER BY created_at DESC, id DESC" {
+		sort.Slice(res, func(i, j int) bool { return res[i].ID > res[j].ID })
+	}
+	if filter.Limit != 0 && len(res) > filter.Limit {
+		res = res[:filter.Limit]
+	}
+	return res
+}
+
+func ids(rows []models.BTC) []int {
+	res := make([]int, 0, len(rows))
+	for _, r := range rows {
+		res = append(res, r.ID)
+	}
+	return res
+}
+
+func TestKeysetPagination(t *testing.T) {
+	tm := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	var rows []models.BTC
+	for i := 1; i <= 5; i++ {
+		// two records share every timestamp to check the id tiebreak
+		createdAt := tm.Add(time.Duration(i/2) * time.Second)
+		rows = append(rows, models.BTC{ID: i, CreatedAt: &createdAt})
+	}
+	page := func(params HistoryParams) ([]int, string, string) {
+		filter, p, err := newHistoryFilter(params, btcTime)
+		require.NoError(t, err)
+		res, next, prev := paginate(selectBTC(rows, filter), btcKeyset, p)
+		return ids(res), next, prev
+	}
+	got, next, prev := page(HistoryParams{Limit: 2})
+	require.Equal(t, []int{1, 2}, got)
+	require.Empty(t, prev)
+	got, next, prev = page(HistoryParams{Limit: 2, Cursor: next})
+	require.Equal(t, []int{3, 4}, got)
+	got, next, _ = page(HistoryParams{Limit: 2, Cursor: next})
+	require.Equal(t, []int{5}, got)
+	require.Empty(t, next)
+	// back from the second page
+	got, next, prev = page(HistoryParams{Limit: 2, Cursor: prev})
+	require.Equal(t, []int{1, 2}, got)
+	require.Empty(t, prev)
+	got, _, _ = page(HistoryParams{Limit: 2, Cursor: next})
+	require.Equal(t, []int{3, 4}, got)
+
+	got, next, _ = page(HistoryParams{Limit: 3, OrderBy: "-created_at"})
+	require.Equal(t, []int{5, 4, 3}, got)
+	got, next, prev = page(HistoryParams{Limit: 3, OrderBy: "-created_at", Cursor: next})
+	require.Equal(t, []int{2, 1}, got)
+	require.Empty(t, next)
+	got, _, _ = page(HistoryParams{Limit: 3, OrderBy: "-created_at", Cursor: prev})
+	require.Equal(t, []int{5, 4, 3}, got)
+}
+
+func TestNewHistoryFilterWithoutCursor(t *testing.T) {
+	// offset and ordering by other columns keep limit/offset pages
+	for _, params := range []HistoryParams{{Limit: 2, Offset: 2}, {Limit: 2, OrderBy: "-value"}, {}} {
+		filter, p, err := newHistoryFilter(params, btcTime)
+		require.NoError(t, err)
+		require.Equal(t, params.Limit, filter.Limit)
+		require.Zero(t, p.limit)
+		require.Nil(t, filter.After)
+	}
+}
+
+func TestNewHistoryFilterError(t *testing.T) {
+	token := encodeCursor(cursor{Time: time.Now(), ID: 1})
+	cases := []HistoryParams{
+		{Cursor: "wrong"},
+		{Cursor: token, Offset: 1},
+		{Cursor: token, OrderBy: "value"},
+		{Cursor: encodeCursor(cursor{ID: 1})},
+	}
+	for _, params := range cases {
+		_, _, err := newHistoryFilter(params, btcTime)
+		require.ErrorIs(t, err, ErrUnexpectedCursor)
+	}
+}
+
+func TestFiatKeysetPagination(t *testing.T) {
+	// backfilled rates are stored after newer ones, the pages follow the effective dates
+	stored := time.Date(2023, 3, 10, 12, 0, 0, 0, time.UTC)
+	var rows []models.Fiat
+	for i := 1; i <= 3; i++ {
+		createdAt := stored.Add(-time.Duration(i) * time.Hour)
+		date := time.Date(2023, 3, i, 0, 0, 0, 0, time.UTC)
+		rows = append(rows, models.Fiat{ID: 4 - i, CreatedAt: &createdAt, EffectiveDate: &date})
+	}
+	filter, p, err := newHistoryFilter(HistoryParams{Limit: 2}, fiatTime)
+	require.NoError(t, err)
+	require.Equal(t, "ORDER BY effective_date, id", filter.OrderBy)
+	_, next, _ := paginate(rows, fiatKeyset, p)
+	filter, _, err = newHistoryFilter(HistoryParams{Limit: 2, Cursor: next}, fiatTime)
+	require.NoError(t, err)
+	require.Equal(t, &models.Keyset{Time: *rows[1].EffectiveDate, ID: rows[1].ID}, filter.After)
+
+	filter, _, err = newHistoryFilter(HistoryParams{Limit: 2, OrderBy: "-effective_date", Cursor: next}, fiatTime)
+	require.NoError(t, err)
+	require.Equal(t, "ORDER BY effective_date DESC, id DESC", filter.OrderBy)
+	// created_at of fiat is paged by offset
+	_, _, err = newHistoryFilter(HistoryParams{Limit: 2, OrderBy: "created_at", Cursor: next}, fiatTime)
+	require.ErrorIs(t, err, ErrUnexpectedCursor)
+	_, _, err = newHistoryFilter(HistoryParams{OrderBy: "effective_date"}, btcTime)
+	require.ErrorIs(t, err, ErrUnexpectedOrderBy)
+}
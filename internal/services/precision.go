@@ -0,0 +1,37 @@
+package services
+
+import (
+	"XTechProject/cmd/config"
+	"github.com/shopspring/decimal"
+	"strings"
+)
+
+// Precision rounds output amounts to the digits after the point configured for their currency
+type Precision struct {
+	fiat, crypto int32
+	currencies   map[string]int32
+}
+
+func NewPrecision(cfg *config.Config) Precision {
+	currencies := make(map[string]int32, len(cfg.Precision.Currencies))
+	for code, places := range cfg.Precision.Currencies {
+		currencies[strings.ToUpper(strings.TrimSpace(code))] = places
+	}
+	return Precision{fiat: cfg.Precision.Fiat, crypto: cfg.Precision.Crypto, currencies: currencies}
+}
+
+// Places returns the digits after the point of the currency, crypto are USDT and the bases of pairs
+func (p Precision) Places(code string, crypto bool) int32 {
+	if places, ok := p.currencies[code]; ok {
+		return places
+	}
+	if crypto {
+		return p.crypto
+	}
+	return p.fiat
+}
+
+// Round rounds half away from zero, like numeric columns of postgres
+func (p Precision) Round(code string, crypto bool, amount decimal.Decimal) decimal.Decimal {
+	return amount.Round(p.Places(code, crypto))
+}
@@ -4,84 +4,226 @@ import (
 	"XTechProject/cmd/config"
 	"XTechProject/internal/models"
 	"XTechProject/internal/repository"
+	"XTechProject/internal/scheduler"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/shopspring/decimal"
 	"log"
-	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 var (
-	ErrUSDNotFound             = errors.New("USD not found")
-	ErrEmptyValuteSlice        = errors.New("empty valutes slice")
-	ErrUnexpectedOrderBy       = errors.New("unexpected order_by")
-	ErrAlreadyUpdatedFiatToday = errors.New("fiat currencies were already updated today")
+	ErrUSDNotFound        = errors.New("USD not found")
+	ErrEmptyValuteSlice   = errors.New("empty valutes slice")
+	ErrUnexpectedOrderBy  = errors.New("unexpected order_by")
+	ErrNotEnoughQuotes    = errors.New("not enough price quotes")
+	ErrUnknownSymbol      = errors.New("unknown symbol")
+	ErrUnexpectedInterval = errors.New("unexpected interval")
+	ErrUnexpectedTime     = errors.New("unexpected time, use RFC3339 or YYYY-MM-DD")
 )
 
 type (
 	ManagementService struct {
-		db  repository.Repositorier
-		cfg *config.Config
+		db     repository.Repositorier
+		cfg    *config.Config
+		prices []PriceSource
+		fiats  []FiatSource
+		// precision rounds the amounts of btc_to_fiat and conversions
+		precision Precision
+
+		symbols []string
+		// last stored price per symbol, a new record is created when it changes
+		lastPrices   map[string]string
+		lastPricesMu sync.Mutex
+
+		// workers are the running workers, workCtx is canceled when they don't finish in time on shutdown
+		workers    sync.WaitGroup
+		workCtx    context.Context
+		cancelWork context.CancelFunc
+		scheduler  *scheduler.Scheduler
 	}
 	Servicer interface {
-		GetLastBTC() (*models.BTC, error)
-		GetAllBTC(limit, offset int, orderBy string) ([]models.BTC, error)
-		GetBTCToFiat(btc *models.BTC) (*map[string]float64, error)
+		Symbols() []string
+		CheckSymbol(symbol string) error
+		Schedule() []scheduler.JobInfo
+		Sources() []SourceStatus
+		StartBackfillBTC(params BackfillParams) error
+		GetLastBTC(ctx context.Context, symbol string) (*models.BTC, error)
+		GetLastBTCFiat(ctx context.Context, symbol, symbols string) (*models.BTC, error)
+		GetAllBTC(ctx context.Context, symbol string, params HistoryParams) ([]models.BTC, *Page, error)
+		GetBTCQuotes(ctx context.Context, btcID int) ([]models.SourceQuote, error)
+		GetCandles(ctx context.Context, symbol, interval, from, to string) ([]models.Candle, error)
+		GetBTCStats(ctx context.Context, symbol, window string) (*Stats, error)
+		GetIndicator(ctx context.Context, symbol string, params IndicatorParams) (*IndicatorSeries, error)
+		GetBTCToFiat(ctx context.Context, btc *models.BTC) (*map[string]decimal.Decimal, error)
+		Convert(ctx context.Context, params ConvertParams) (*Conversion, error)
+		Matrix(ctx context.Context, params MatrixParams) (*Matrix, error)
 
-		GetLastFiat() (*models.Fiat, error)
-		GetFiatHistory(limit, offset int, orderBy string) ([]models.Fiat, error)
-		CheckLastDateUpdatingFiatCurrencies() error
+		GetLastFiat(ctx context.Context, symbols string) (*models.Fiat, error)
+		GetFiatHistory(ctx context.Context, params HistoryParams, symbols string) ([]models.Fiat, *Page, error)
+		GetCurrencyHistory(ctx context.Context, params CurrencyHistoryParams) ([]models.CurrencyPoint, *Page, error)
+		GetCurrencyStats(ctx context.Context, charCode, window string) (*Stats, error)
 	}
 )
 
-func NewManagementService(db repository.Repositorier, cfg *config.Config) *ManagementService {
-	svc := &ManagementService{db: db, cfg: cfg}
-	return svc
+func NewManagementService(db repository.Repositorier, cfg *config.Config) (*ManagementService, error) {
+	prices, err := NewPriceSources(cfg)
+	if err != nil {
+		return nil, err
+	}
+	fiats, err := NewFiatSources(cfg)
+	if err != nil {
+		return nil, err
+	}
+	symbols := make([]string, 0, len(cfg.Symbols))
+	for _, symbol := range cfg.Symbols {
+		symbol = strings.ToUpper(strings.TrimSpace(symbol))
+		if _, _, err := splitSymbol(symbol); err != nil {
+			return nil, err
+		}
+		symbols = append(symbols, symbol)
+	}
+	svc := &ManagementService{
+		db:         db,
+		cfg:        cfg,
+		prices:     prices,
+		fiats:      fiats,
+		symbols:    symbols,
+		lastPrices: make(map[string]string, len(symbols)),
+		precision:  NewPrecision(cfg),
+	}
+	svc.workCtx, svc.cancelWork = context.WithCancel(context.Background())
+	if svc.scheduler, err = svc.newScheduler(); err != nil {
+		return nil, err
+	}
+	return svc, nil
 }
 
-func (svc *ManagementService) RunWorkers() {
-	// first starting after running server
-	go svc.BTCWorker()
-	// fiat will not created if it was already created today
-	go svc.FiatWorker()
-	// tickers will trigger workers
-	tickerForBTC := time.NewTicker(time.Second * 10).C
-	tickerForFiat := time.NewTicker(time.Hour * 24).C
-	for {
-		select {
-		case <-tickerForBTC:
-			go svc.BTCWorker()
-		case <-tickerForFiat:
-			go svc.FiatWorker()
+// newScheduler plans the workers by cfg.Schedule
+func (svc *ManagementService) newScheduler() (*scheduler.Scheduler, error) {
+	loc, err := time.LoadLocation(svc.cfg.Schedule.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("error in LoadLocation: %w", err)
+	}
+	btc, err := scheduler.Parse(svc.cfg.Schedule.BTC, loc)
+	if err != nil {
+		return nil, fmt.Errorf("error in BTC schedule: %w", err)
+	}
+	fiat, err := scheduler.Parse(svc.cfg.Schedule.Fiat, loc)
+	if err != nil {
+		return nil, fmt.Errorf("error in fiat schedule: %w", err)
+	}
+	// new rates of the primary source take effect at midnight where it sets them
+	effective, err := scheduler.ParseCron("0 0 * * *", fiatLocation(svc.primaryFiatSource()))
+	if err != nil {
+		return nil, fmt.Errorf("error in fiat-effective schedule: %w", err)
+	}
+	s := scheduler.New()
+	s.Add("btc", btc, svc.cfg.Schedule.BTCJitter, func() { svc.goWorker(svc.BTCWorker) })
+	s.Add("fiat", fiat, svc.cfg.Schedule.FiatJitter, func() { svc.goWorker(svc.FiatWorker) })
+	s.Add("fiat-effective", effective, 0, func() { svc.goWorker(svc.EffectiveFiatWorker) })
+	return s, nil
+}
+
+// Sources returns the circuit breaker states of the price and fiat sources
+func (svc *ManagementService) Sources() []SourceStatus {
+	sources := make([]SourceStatus, 0, len(svc.prices)+len(svc.fiats))
+	for _, s := range svc.prices {
+		sources = append(sources, SourceStatus{Name: s.Name(), Kind: "price", Status: s.Status()})
+	}
+	for _, s := range svc.fiats {
+		sources = append(sources, SourceStatus{Name: s.Name(), Kind: "fiat", Status: s.Status()})
+	}
+	return sources
+}
+
+// Schedule returns the worker jobs with their next run times
+func (svc *ManagementService) Schedule() []scheduler.JobInfo {
+	return svc.scheduler.Jobs()
+}
+
+func (svc *ManagementService) Symbols() []string {
+	return svc.symbols
+}
+
+func (svc *ManagementService) CheckSymbol(symbol string) error {
+	for _, s := range svc.symbols {
+		if s == symbol {
+			return nil
 		}
 	}
+	return fmt.Errorf("%w: %s", ErrUnknownSymbol, symbol)
+}
+
+// RunWorkers triggers the workers until ctx is done, Shutdown waits for the ones that are still running
+func (svc *ManagementService) RunWorkers(ctx context.Context) {
+	// first starting after running server
+	svc.goWorker(svc.BTCWorker)
+	// fiat will not created if it was already created today
+	svc.goWorker(svc.FiatWorker)
+	// rates that took effect while the service was down
+	svc.goWorker(svc.EffectiveFiatWorker)
+	// the scheduler will trigger workers
+	svc.scheduler.Run(ctx)
 }
 
-func (svc *ManagementService) UpdateBTCInDB(unixTime int64, lastValue string) {
-	if err := svc.db.UpdateLastRecordForBTC(); err != nil {
-		log.Printf("BTCWorker: error in UpdateLastRecordForBTC, err %s\n", err)
+// goWorker runs the worker with the context of in-flight work, it is canceled only when Shutdown runs out of time
+func (svc *ManagementService) goWorker(worker func(ctx context.Context)) {
+	svc.workers.Add(1)
+	go func() {
+		defer svc.workers.Done()
+		worker(svc.workCtx)
+	}()
+}
+
+// Shutdown waits for the running workers after RunWorkers has returned.
+// When ctx is done first, their work is canceled and ctx.Err() is returned.
+func (svc *ManagementService) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		svc.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		svc.cancelWork()
+		<-done
+		return ctx.Err()
 	}
-	inUSDT, err := strconv.ParseFloat(lastValue, 64)
+}
+
+func (svc *ManagementService) UpdateBTCInDB(ctx context.Context, symbol string, unixTime int64, lastValue string, quotes []models.SourceQuote) {
+	inUSDT, err := decimal.NewFromString(lastValue)
 	if err != nil {
-		log.Printf("BTCWorker: error in ParseFloat(lastValue, 64), err %s\n", err)
+		log.Printf("BTCWorker: error in decimal.NewFromString(lastValue), err %s\n", err)
+		return
 	}
 	btc := &models.BTC{
+		Symbol:    symbol,
 		InUSDT:    inUSDT,
 		CreatedAt: unixTimeToTime(unixTime),
 		Latest:    true,
+		Quotes:    quotes,
 	}
-	if err = svc.db.CreateBTCRecord(btc); err != nil {
-		log.Printf("BTCWorker: error in CreateBTCRecord, err %s\n", err)
+	// the previous record stops being latest in the same transaction
+	if err = svc.db.CreateLatestBTCRecord(ctx, btc); err != nil {
+		log.Printf("BTCWorker: error in CreateLatestBTCRecord, err %s\n", err)
+		return
 	}
-	log.Println("BTC updated in db")
-	if err := svc.UpdateBTCToFiatInDB(btc); err != nil {
+	log.Printf("%s updated in db\n", symbol)
+	if err := svc.UpdateBTCToFiatInDB(ctx, btc); err != nil {
 		log.Printf("BTCWorker: error in UpdateBTCToFiatInDB, err %s\n", err)
 	}
 }
 
-func (svc *ManagementService) UpdateBTCToFiatInDB(btc *models.BTC) error {
-	btcToFiat, err := svc.GetBTCToFiat(btc)
+func (svc *ManagementService) UpdateBTCToFiatInDB(ctx context.Context, btc *models.BTC) error {
+	btcToFiat, err := svc.GetBTCToFiat(ctx, btc)
 	if err != nil {
 		return fmt.Errorf("error in GetBTCToFiat(btc), err: %w", err)
 	}
@@ -89,82 +231,190 @@ func (svc *ManagementService) UpdateBTCToFiatInDB(btc *models.BTC) error {
 	if err != nil {
 		return fmt.Errorf("error in json.Marshal(btcToFiat), err: %w", err)
 	}
-	if err = svc.db.UpdateFiatForLastBTC(btc); err != nil {
+	if err = svc.db.UpdateFiatForLastBTC(ctx, btc); err != nil {
 		return fmt.Errorf("error in UpdateFiatForLastBTC(btc), err: %w", err)
 	}
-	log.Println("BTC/Fiat updated in db")
+	log.Printf("%s/Fiat updated in db\n", btc.Symbol)
 	return nil
 }
 
-func (svc *ManagementService) GetBTCToFiat(btc *models.BTC) (*map[string]float64, error) {
-	lastFiat, err := svc.db.GetLastFiat()
+// GetBTCToFiat prices the record with the fiat rates that were in effect at its CreatedAt,
+// so recalculated and backfilled records don't get the rates of today
+func (svc *ManagementService) GetBTCToFiat(ctx context.Context, btc *models.BTC) (*map[string]decimal.Decimal, error) {
+	at := time.Now()
+	if btc.CreatedAt != nil {
+		at = *btc.CreatedAt
+	}
+	source := svc.primaryFiatSource()
+	fiat, err := svc.db.GetFiatAsOf(ctx, source, fiatDate(source, at))
 	if err != nil {
-		return nil, fmt.Errorf("error in GetLastFiat: %w", err)
+		return nil, fmt.Errorf("error in GetFiatAsOf: %w", err)
 	}
+	btcToFiat, err := svc.priceInFiat(btc, fiat)
+	if err != nil {
+		return nil, err
+	}
+	return &btcToFiat, nil
+}
+
+// priceInFiat sets InRub of the record from the rates and returns its price in every currency of them
+func (svc *ManagementService) priceInFiat(btc *models.BTC, fiat *models.Fiat) (map[string]decimal.Decimal, error) {
 	var currencies []models.Currency
-	if err := json.Unmarshal(lastFiat.Currencies, &currencies); err != nil {
+	if err := json.Unmarshal(fiat.Currencies, &currencies); err != nil {
 		return nil, fmt.Errorf("error in json.Unmarshal: %w", err)
 	}
-	btc.InRub = btc.InUSDT * lastFiat.USDRUB
-	btcToFiat, err := calculateBTCToFiat(currencies, btc.InRub)
+	// InRub is in the base currency of the primary source, RUB for CBR, the column keeps 8 digits
+	btc.InRub = btc.InUSDT.Mul(fiat.USDRUB).Round(8)
+	return calculateBTCToFiat(currencies, fiat.Base, btc.InRub, svc.precision)
+}
+
+func (svc *ManagementService) GetLastBTC(ctx context.Context, symbol string) (*models.BTC, error) {
+	model, err := svc.db.GetLastBTC(ctx, symbol)
+	if err != nil {
+		return nil, fmt.Errorf("error in GetLastBTC: %w", err)
+	}
+	return model, nil
+}
+
+// GetLastBTCFiat returns the latest record of the pair with its prices in the comma separated currencies of symbols,
+// in all currencies when symbols is empty
+func (svc *ManagementService) GetLastBTCFiat(ctx context.Context, symbol, symbols string) (*models.BTC, error) {
+	codes, err := svc.currencyCodes(ctx, symbols)
 	if err != nil {
 		return nil, err
 	}
-	return &btcToFiat, nil
+	model, err := svc.db.GetLastBTCFiat(ctx, symbol, codes)
+	if err != nil {
+		return nil, fmt.Errorf("error in GetLastBTCFiat: %w", err)
+	}
+	return model, nil
 }
 
-func (svc *ManagementService) CheckLastDateUpdatingFiatCurrencies() error {
-	date, err := svc.db.GetLastDateForFiat()
+func (svc *ManagementService) GetAllBTC(ctx context.Context, symbol string, params HistoryParams) ([]models.BTC, *Page, error) {
+	filter, p, err := newHistoryFilter(params, btcTime)
 	if err != nil {
-		return fmt.Errorf("error in GetLastDateForFiaty, err: %s\n", err.Error())
+		return nil, nil, err
 	}
-	if date != nil {
-		// if we already have data today -> skip
-		d := date.Format(time.RFC3339[:10])
-		t := time.Now().Format(time.RFC3339[:10])
-		if d == t {
-			return ErrAlreadyUpdatedFiatToday
-		}
+	modelsData, err := svc.db.GetAllBTC(ctx, symbol, *filter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error to get all btcusdt data, err: %w", err)
 	}
-	return nil
+	total, err := svc.db.CountBTC(ctx, symbol, *filter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error in CountBTC: %w", err)
+	}
+	page := &Page{Total: total}
+	modelsData, page.NextCursor, page.PrevCursor = paginate(modelsData, btcKeyset, p)
+	return modelsData, page, nil
 }
 
-func (svc *ManagementService) GetLastBTC() (*models.BTC, error) {
-	model, err := svc.db.GetLastBTC()
+func (svc *ManagementService) GetBTCQuotes(ctx context.Context, btcID int) ([]models.SourceQuote, error) {
+	quotes, err := svc.db.GetBTCQuotes(ctx, btcID)
 	if err != nil {
-		return nil, fmt.Errorf("error in GetLastBTC: %w", err)
+		return nil, fmt.Errorf("error in GetBTCQuotes: %w", err)
 	}
-	return model, nil
+	return quotes, nil
 }
 
-func (svc *ManagementService) GetAllBTC(limit, offset int, orderBy string) ([]models.BTC, error) {
-	orderBy, err := serializeOrderBy(orderBy)
+func (svc *ManagementService) GetCandles(ctx context.Context, symbol, interval, from, to string) ([]models.Candle, error) {
+	pgInterval, err := serializeInterval(interval)
 	if err != nil {
-		return nil, fmt.Errorf("error in serializeOrderBy: %w", err)
+		return nil, err
+	}
+	fromTime, err := parseTime(from)
+	if err != nil {
+		return nil, err
 	}
-	modelsData, err := svc.db.GetAllBTC(limit, offset, orderBy)
+	toTime, err := parseTime(to)
 	if err != nil {
-		return nil, fmt.Errorf("error to get all btcusdt data, err: %w", err)
+		return nil, err
 	}
-	return modelsData, nil
+	candles, err := svc.db.GetCandles(ctx, symbol, pgInterval, fromTime, toTime)
+	if err != nil {
+		return nil, fmt.Errorf("error in GetCandles: %w", err)
+	}
+	return candles, nil
 }
 
-func (svc *ManagementService) GetLastFiat() (*models.Fiat, error) {
-	model, err := svc.db.GetLastFiat()
+// GetLastFiat returns the latest rates with the comma separated currencies of symbols, all of them when it is empty
+func (svc *ManagementService) GetLastFiat(ctx context.Context, symbols string) (*models.Fiat, error) {
+	codes, err := svc.currencyCodes(ctx, symbols)
+	if err != nil {
+		return nil, err
+	}
+	model, err := svc.db.GetLastFiat(ctx, svc.primaryFiatSource(), codes)
 	if err != nil {
 		return nil, fmt.Errorf("error in GetLastFiat: %w", err)
 	}
 	return model, nil
 }
 
-func (svc *ManagementService) GetFiatHistory(limit, offset int, orderBy string) ([]models.Fiat, error) {
-	orderBy, err := serializeOrderBy(orderBy)
+// GetFiatHistory returns a page of rates with the comma separated currencies of symbols, all of them when it is empty
+func (svc *ManagementService) GetFiatHistory(ctx context.Context, params HistoryParams, symbols string) ([]models.Fiat, *Page, error) {
+	filter, p, err := newHistoryFilter(params, fiatTime)
+	if err != nil {
+		return nil, nil, err
+	}
+	if filter.Codes, err = svc.currencyCodes(ctx, symbols); err != nil {
+		return nil, nil, err
+	}
+	modelsData, err := svc.db.GetAllFiat(ctx, svc.primaryFiatSource(), *filter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error in GetAllFiat: %w", err)
+	}
+	total, err := svc.db.CountFiat(ctx, svc.primaryFiatSource(), *filter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error in CountFiat: %w", err)
+	}
+	page := &Page{Total: total}
+	modelsData, page.NextCursor, page.PrevCursor = paginate(modelsData, fiatKeyset, p)
+	return modelsData, page, nil
+}
+
+// CurrencyHistoryParams are the request parameters of the history of one currency, From and To are dates inclusive
+type CurrencyHistoryParams struct {
+	CharCode string
+	Interval string
+	From     string
+	To       string
+	Limit    int
+	Offset   int
+}
+
+// GetCurrencyHistory returns the values of a currency of the primary source, downsampled to one point per interval
+func (svc *ManagementService) GetCurrencyHistory(ctx context.Context, params CurrencyHistoryParams) ([]models.CurrencyPoint, *Page, error) {
+	bucket, err := serializeBucket(params.Interval)
+	if err != nil {
+		return nil, nil, err
+	}
+	fromTime, err := parseTime(params.From)
+	if err != nil {
+		return nil, nil, err
+	}
+	toTime, err := parseTime(params.To)
+	if err != nil {
+		return nil, nil, err
+	}
+	filter := models.CurrencyHistoryFilter{
+		CharCode: strings.ToUpper(params.CharCode),
+		Bucket:   bucket,
+		From:     fromTime,
+		To:       toTime,
+		Limit:    params.Limit,
+		Offset:   params.Offset,
+	}
+	points, err := svc.db.GetCurrencyHistory(ctx, svc.primaryFiatSource(), filter)
 	if err != nil {
-		return nil, fmt.Errorf("error in serializeOrderBy: %w", err)
+		return nil, nil, fmt.Errorf("error in GetCurrencyHistory: %w", err)
 	}
-	modelsData, err := svc.db.GetAllFiat(limit, offset, orderBy)
+	total, err := svc.db.CountCurrencyHistory(ctx, svc.primaryFiatSource(), filter)
 	if err != nil {
-		return nil, fmt.Errorf("error in GetAllFiat: %w", err)
+		return nil, nil, fmt.Errorf("error in CountCurrencyHistory: %w", err)
 	}
-	return modelsData, nil
+	return points, &Page{Total: total}, nil
+}
+
+// primaryFiatSource is the source the API and BTC/Fiat conversion use
+func (svc *ManagementService) primaryFiatSource() string {
+	return svc.fiats[0].Name()
 }
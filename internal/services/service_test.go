@@ -2,11 +2,15 @@ package services
 
 import (
 	"XTechProject/cmd/config"
+	"XTechProject/internal/analytics"
 	"XTechProject/internal/models"
 	mock_repository "XTechProject/internal/repository/mocks"
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"github.com/golang/mock/gomock"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/require"
 	"strconv"
 	"testing"
@@ -15,16 +19,16 @@ import (
 
 func TestGetResponse(t *testing.T) {
 	link := "https://github.com/AlexanderValov"
-	_, err := getResponse(link)
+	_, err := getResponse(context.Background(), nil, link)
 	require.NoError(t, err)
 }
 
 func TestGetResponseError(t *testing.T) {
 	link := "https://github.com/AlexanderValov12344"
-	_, err := getResponse(link)
+	_, err := getResponse(context.Background(), nil, link)
 	require.Error(t, err)
 	link = "https://13.com/2"
-	_, err = getResponse(link)
+	_, err = getResponse(context.Background(), nil, link)
 	require.Error(t, err)
 }
 
@@ -55,7 +59,7 @@ func TestSerializeFiatCurrenciesData(t *testing.T) {
 	var expData []models.Currency
 	_ = json.Unmarshal(data, &expData)
 	require.Equal(t, len(expData), len(correctInput))
-	require.Equal(t, usdrub, 80.551)
+	requireDecimal(t, "80.551", usdrub)
 	// test to check that struct generate ok
 	correctInput = []Valute{
 		{
@@ -74,7 +78,7 @@ func TestSerializeFiatCurrenciesData(t *testing.T) {
 			Nominal:  1,
 			CharCode: correctInput[0].CharCode,
 			NumCode:  correctInput[0].NumCode,
-			Val:      80.551,
+			Val:      decimal.RequireFromString("80.551"),
 		},
 	}
 	data, _, err = serializeFiatCurrenciesData(correctInput)
@@ -197,6 +201,39 @@ func TestSerializeOrderByError(t *testing.T) {
 	require.Equal(t, "", ans)
 }
 
+func TestAggregateTicks(t *testing.T) {
+	ticks := []*Tick{
+		{Source: SourceKuCoin, Price: "100", Time: 1671542754000},
+		{Source: SourceBinance, Price: "101", Time: 1671542754002},
+		{Source: SourceCoinbase, Price: "102", Time: 1671542754001},
+		{Source: SourceKraken, Price: "150", Time: 1671542754003},
+	}
+	price, unixTime, quotes, err := aggregateTicks(ticks, 0.02, 3)
+	require.NoError(t, err)
+	requireDecimal(t, "101", price)
+	require.Equal(t, int64(1671542754002), unixTime)
+	require.Len(t, quotes, 4)
+	for _, q := range quotes {
+		require.Equal(t, q.Source != SourceKraken, q.Accepted)
+	}
+	// the same quotes without the outlier give the same median for an even number
+	price, _, _, err = aggregateTicks(ticks[:2], 0.02, 1)
+	require.NoError(t, err)
+	requireDecimal(t, "100.5", price)
+}
+
+func TestAggregateTicksError(t *testing.T) {
+	_, _, _, err := aggregateTicks(nil, 0.02, 1)
+	require.ErrorIs(t, err, ErrNotEnoughQuotes)
+	ticks := []*Tick{
+		{Source: SourceKuCoin, Price: "100"},
+		{Source: SourceBinance, Price: "200"},
+		{Source: SourceKraken, Price: "wrong"},
+	}
+	_, _, _, err = aggregateTicks(ticks, 0.02, 1)
+	require.ErrorIs(t, err, ErrNotEnoughQuotes)
+}
+
 func TestUpdateBTCInDB(t *testing.T) {
 	ctl := gomock.NewController(t)
 	defer ctl.Finish()
@@ -211,7 +248,7 @@ func TestUpdateBTCInDB(t *testing.T) {
 			Nominal:  1,
 			CharCode: "test",
 			NumCode:  "123",
-			Val:      80.551,
+			Val:      decimal.RequireFromString("80.551"),
 		},
 		{
 			ID:       "2",
@@ -219,7 +256,7 @@ func TestUpdateBTCInDB(t *testing.T) {
 			Nominal:  1,
 			CharCode: "USD",
 			NumCode:  "1234",
-			Val:      70.551,
+			Val:      decimal.RequireFromString("70.551"),
 		},
 		{
 			ID:       "2",
@@ -227,11 +264,13 @@ func TestUpdateBTCInDB(t *testing.T) {
 			Nominal:  1,
 			CharCode: "RUB",
 			NumCode:  "1234",
-			Val:      666.6 * 70.551,
+			Val:      decimal.RequireFromString("47029.2966"),
 		},
 	}
 	expFiat := &models.Fiat{
 		ID:        1,
+		Source:    FiatSourceCBR,
+		Base:      "RUB",
 		Latest:    true,
 		CreatedAt: &tm,
 		USDRUB:    cur[1].Val,
@@ -242,28 +281,192 @@ func TestUpdateBTCInDB(t *testing.T) {
 	lastValue := "666.6"
 	btc1 := &models.BTC{
 		ID:        0,
-		InUSDT:    666.6,
+		Symbol:    models.SymbolBTCUSDT,
+		InUSDT:    decimal.RequireFromString("666.6"),
 		Latest:    true,
 		CreatedAt: unixTimeToTime(unixTime),
 	}
-	repo.EXPECT().UpdateLastRecordForBTC().Return(nil).Times(1)
-	repo.EXPECT().CreateBTCRecord(btc1).Return(nil).Times(1)
+	repo.EXPECT().CreateLatestBTCRecord(gomock.Any(), btc1).Return(nil).Times(1)
 	btc2 := &models.BTC{
 		ID:        0,
-		InUSDT:    666.6,
-		InRub:     cur[1].Val * 666.6,
+		Symbol:    models.SymbolBTCUSDT,
+		InUSDT:    decimal.RequireFromString("666.6"),
+		InRub:     decimal.RequireFromString("666.6").Mul(cur[1].Val).Round(8),
 		Latest:    true,
 		CreatedAt: unixTimeToTime(unixTime),
 	}
-	btcToFiat, err := calculateBTCToFiat(cur, btc2.InRub)
+	btcToFiat, err := calculateBTCToFiat(cur, "RUB", btc2.InRub, NewPrecision(cfg))
 	require.NoError(t, err)
 	btc2.BTCToFiat, err = json.Marshal(btcToFiat)
 	require.NoError(t, err)
-	repo.EXPECT().GetLastFiat().Return(expFiat, nil).Times(1)
-	repo.EXPECT().UpdateFiatForLastBTC(btc2).Return(nil).Times(1)
-	srv := NewManagementService(repo, cfg)
-	srv.UpdateBTCInDB(unixTime, lastValue)
+	// the rates in effect at the time of the record
+	repo.EXPECT().GetFiatAsOf(gomock.Any(), FiatSourceCBR, truncateDay(btc2.CreatedAt.In(moscow(t)))).
+		Return(expFiat, nil).Times(1)
+	repo.EXPECT().UpdateFiatForLastBTC(gomock.Any(), btc2).Return(nil).Times(1)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+	srv.UpdateBTCInDB(context.Background(), models.SymbolBTCUSDT, unixTime, lastValue, nil)
+	require.NoError(t, err)
+}
+
+func TestGetBTCToFiatAsOf(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	cfg, err := config.New()
 	require.NoError(t, err)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+	currencies, err := json.Marshal([]models.Currency{{CharCode: "USD", Nominal: 1, Val: decimal.NewFromInt(70)}})
+	require.NoError(t, err)
+	fiat := &models.Fiat{Source: FiatSourceCBR, Base: "RUB", USDRUB: decimal.NewFromInt(70), Currencies: currencies}
+	// it is already December 21 in Moscow
+	createdAt := time.Date(2022, 12, 20, 22, 30, 0, 0, time.UTC)
+	repo.EXPECT().GetFiatAsOf(gomock.Any(), FiatSourceCBR, time.Date(2022, 12, 21, 0, 0, 0, 0, time.UTC)).
+		Return(fiat, nil).Times(1)
+	btc := &models.BTC{Symbol: models.SymbolBTCUSDT, InUSDT: decimal.NewFromInt(2), CreatedAt: &createdAt}
+	btcToFiat, err := srv.GetBTCToFiat(context.Background(), btc)
+	require.NoError(t, err)
+	requireDecimal(t, "140", btc.InRub)
+	require.Len(t, *btcToFiat, 2)
+	requireDecimal(t, "2", (*btcToFiat)["USD"])
+	requireDecimal(t, "140", (*btcToFiat)["RUB"])
+
+	expErr := errors.New("test error")
+	repo.EXPECT().GetFiatAsOf(gomock.Any(), FiatSourceCBR, gomock.Any()).Return(nil, expErr).Times(1)
+	_, err = srv.GetBTCToFiat(context.Background(), btc)
+	require.ErrorIs(t, err, expErr)
+}
+
+// requireDecimal compares by value, decimals of the same value can differ by their exponent
+func requireDecimal(t *testing.T, expected string, actual decimal.Decimal) {
+	t.Helper()
+	require.Truef(t, decimal.RequireFromString(expected).Equal(actual), "expected %s, got %s", expected, actual)
+}
+
+func moscow(t *testing.T) *time.Location {
+	loc, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+	return loc
+}
+
+// staticFiatSource returns the same rates on every call
+type staticFiatSource struct {
+	upstream
+	fiat *models.Fiat
+}
+
+func (s staticFiatSource) Name() string { return s.fiat.Source }
+
+func (s staticFiatSource) Base() string { return s.fiat.Base }
+
+func (s staticFiatSource) GetFiat(ctx context.Context) (*models.Fiat, error) { return s.fiat, nil }
+
+func TestUpdateFiatInDB(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	cfg, err := config.New()
+	require.NoError(t, err)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+	date := time.Date(2022, 12, 21, 0, 0, 0, 0, time.UTC)
+	fiat := &models.Fiat{Source: FiatSourceCBR, Base: "RUB", Latest: true, EffectiveDate: &date, USDRUB: decimal.RequireFromString("70.551")}
+	// no separate reset of the latest flag
+	repo.EXPECT().CreateLatestFiatRecord(gomock.Any(), fiat).Return(true, nil).Times(1)
+	// there are no BTC records to price again yet
+	repo.EXPECT().GetLastBTC(gomock.Any(), models.SymbolBTCUSDT).Return(nil, sql.ErrNoRows).Times(1)
+	srv.UpdateFiatInDB(context.Background(), staticFiatSource{fiat: fiat})
+}
+
+func TestRecalculateBTCToFiat(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	cfg, err := config.New()
+	require.NoError(t, err)
+	cfg.Fiat.ReprocessDay = true
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+	date := time.Date(2022, 12, 21, 0, 0, 0, 0, time.UTC)
+	currencies, err := json.Marshal([]models.Currency{{CharCode: "USD", Nominal: 1, Val: decimal.NewFromInt(70)}})
+	require.NoError(t, err)
+	fiat := &models.Fiat{Source: FiatSourceCBR, Base: "RUB", EffectiveDate: &date, USDRUB: decimal.NewFromInt(70), Currencies: currencies}
+
+	// the day of the rates starts at midnight in Moscow
+	from := time.Date(2022, 12, 21, 0, 0, 0, 0, moscow(t))
+	to := from.AddDate(0, 0, 1)
+	createdAt := time.Date(2022, 12, 21, 9, 0, 0, 0, time.UTC)
+	day := []models.BTC{{ID: 1, Symbol: models.SymbolBTCUSDT, InUSDT: decimal.NewFromInt(1), CreatedAt: &createdAt}}
+	repo.EXPECT().GetAllBTC(gomock.Any(), models.SymbolBTCUSDT, models.HistoryFilter{From: &from, To: &to}).
+		Return(day, nil).Times(1)
+	repo.EXPECT().UpdateFiatForBTCRecords(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, records []models.BTC) error {
+			require.Len(t, records, 1)
+			requireDecimal(t, "70", records[0].InRub)
+			require.JSONEq(t, `{"USD":1,"RUB":70}`, string(records[0].BTCToFiat))
+			return nil
+		}).Times(1)
+	// the latest record is priced with the new rates
+	last := &models.BTC{ID: 2, Symbol: models.SymbolBTCUSDT, InUSDT: decimal.NewFromInt(2), Latest: true, CreatedAt: &createdAt}
+	repo.EXPECT().GetLastBTC(gomock.Any(), models.SymbolBTCUSDT).Return(last, nil).Times(1)
+	repo.EXPECT().UpdateFiatForLastBTC(gomock.Any(), last).Return(nil).Times(1)
+	srv.RecalculateBTCToFiat(context.Background(), fiat)
+	requireDecimal(t, "140", last.InRub)
+}
+
+func TestUpdateFiatInDBNextDay(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	cfg, err := config.New()
+	require.NoError(t, err)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+	// CBR publishes at 15:30 the rates of the next day
+	today := fiatDate(FiatSourceCBR, time.Now())
+	tomorrow := today.AddDate(0, 0, 1)
+	currencies, err := json.Marshal([]models.Currency{{CharCode: "USD", Nominal: 1, Val: decimal.NewFromInt(75)}})
+	require.NoError(t, err)
+	fiat := &models.Fiat{Source: FiatSourceCBR, Base: "RUB", Latest: true, EffectiveDate: &tomorrow, USDRUB: decimal.NewFromInt(75), Currencies: currencies}
+	// the prices of today are not touched by the rates of tomorrow
+	repo.EXPECT().CreateLatestFiatRecord(gomock.Any(), fiat).Return(true, nil).Times(1)
+	srv.UpdateFiatInDB(context.Background(), staticFiatSource{fiat: fiat})
+
+	// nothing changes on a day the rates of a previous day are still in effect
+	yesterday := today.AddDate(0, 0, -1)
+	previous := &models.Fiat{Source: FiatSourceCBR, Base: "RUB", EffectiveDate: &yesterday, USDRUB: decimal.NewFromInt(70), Currencies: currencies}
+	repo.EXPECT().GetFiatAsOf(gomock.Any(), FiatSourceCBR, today).Return(previous, nil).Times(1)
+	srv.applyEffectiveFiat(context.Background(), today)
+
+	// when tomorrow starts the latest record stored today is priced with the new rates
+	createdAt := today.Add(23 * time.Hour)
+	last := &models.BTC{ID: 1, Symbol: models.SymbolBTCUSDT, InUSDT: decimal.NewFromInt(2), Latest: true, CreatedAt: &createdAt}
+	repo.EXPECT().GetFiatAsOf(gomock.Any(), FiatSourceCBR, tomorrow).Return(fiat, nil).Times(1)
+	repo.EXPECT().GetLastBTC(gomock.Any(), models.SymbolBTCUSDT).Return(last, nil).Times(1)
+	repo.EXPECT().UpdateFiatForLastBTC(gomock.Any(), last).DoAndReturn(
+		func(ctx context.Context, btc *models.BTC) error {
+			requireDecimal(t, "150", btc.InRub)
+			require.JSONEq(t, `{"USD":2,"RUB":150}`, string(btc.BTCToFiat))
+			return nil
+		}).Times(1)
+	srv.applyEffectiveFiat(context.Background(), tomorrow)
+}
+
+func TestUpdateFiatInDBStoredDate(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	cfg, err := config.New()
+	require.NoError(t, err)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+	date := time.Date(2022, 12, 21, 0, 0, 0, 0, time.UTC)
+	fiat := &models.Fiat{Source: FiatSourceCBR, Base: "RUB", Latest: true, EffectiveDate: &date, USDRUB: decimal.RequireFromString("70.551")}
+	// the rates are fetched on every run, the repository skips a date it already has
+	repo.EXPECT().CreateLatestFiatRecord(gomock.Any(), fiat).Return(false, nil).Times(2)
+	srv.UpdateFiatInDB(context.Background(), staticFiatSource{fiat: fiat})
+	srv.UpdateFiatInDB(context.Background(), staticFiatSource{fiat: fiat})
 }
 
 func TestGetFiatHistory(t *testing.T) {
@@ -272,7 +475,8 @@ func TestGetFiatHistory(t *testing.T) {
 	repo := mock_repository.NewMockRepositorier(ctl)
 	cfg, err := config.New()
 	require.NoError(t, err)
-	srv := NewManagementService(repo, cfg)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
 	type inoutStruct struct {
 		limit   int
 		offset  int
@@ -312,11 +516,14 @@ func TestGetFiatHistory(t *testing.T) {
 	for _, c := range cases {
 		orderByAfterSerialize, err := serializeOrderBy(c.input.orderBy)
 		require.NoError(t, err)
-		repo.EXPECT().GetAllFiat(c.input.limit, c.input.offset, orderByAfterSerialize).Return([]models.Fiat{}, c.expErr).Times(1)
-		repo.EXPECT().GetAllBTC(c.input.limit, c.input.offset, orderByAfterSerialize).Return([]models.BTC{}, c.expErr).Times(1)
-		_, err = srv.GetFiatHistory(c.input.limit, c.input.offset, c.input.orderBy)
+		expFilter := models.HistoryFilter{Limit: c.input.limit, Offset: c.input.offset, OrderBy: orderByAfterSerialize}
+		repo.EXPECT().GetAllFiat(gomock.Any(), FiatSourceCBR, expFilter).Return([]models.Fiat{}, c.expErr).Times(1)
+		repo.EXPECT().CountFiat(gomock.Any(), FiatSourceCBR, expFilter).Return(0, c.expErr).Times(1)
+		repo.EXPECT().GetAllBTC(gomock.Any(), models.SymbolBTCUSDT, expFilter).Return([]models.BTC{}, c.expErr).Times(1)
+		repo.EXPECT().CountBTC(gomock.Any(), models.SymbolBTCUSDT, expFilter).Return(0, c.expErr).Times(1)
+		_, _, err = srv.GetFiatHistory(context.Background(), HistoryParams{Limit: c.input.limit, Offset: c.input.offset, OrderBy: c.input.orderBy}, "")
 		require.NoError(t, err)
-		_, err = srv.GetAllBTC(c.input.limit, c.input.offset, c.input.orderBy)
+		_, _, err = srv.GetAllBTC(context.Background(), models.SymbolBTCUSDT, HistoryParams{Limit: c.input.limit, Offset: c.input.offset, OrderBy: c.input.orderBy})
 		require.NoError(t, err)
 	}
 }
@@ -327,26 +534,92 @@ func TestGetFiatHistoryError(t *testing.T) {
 	repo := mock_repository.NewMockRepositorier(ctl)
 	cfg, err := config.New()
 	require.NoError(t, err)
-	srv := NewManagementService(repo, cfg)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
 	orderBy := "wrong"
-	_, err = srv.GetFiatHistory(0, 0, orderBy)
+	_, _, err = srv.GetFiatHistory(context.Background(), HistoryParams{OrderBy: orderBy}, "")
 	require.ErrorIs(t, err, ErrUnexpectedOrderBy)
 
 	expOutput := ([]models.Fiat)(nil)
 	expErr := errors.New("db is off")
-	repo.EXPECT().GetAllFiat(0, 0, "").Return(expOutput, expErr).Times(1)
-	history, err := srv.GetFiatHistory(0, 0, "")
+	repo.EXPECT().GetAllFiat(gomock.Any(), FiatSourceCBR, models.HistoryFilter{}).Return(expOutput, expErr).Times(1)
+	history, _, err := srv.GetFiatHistory(context.Background(), HistoryParams{}, "")
 	require.ErrorIs(t, err, expErr)
 	require.Equal(t, expOutput, history)
 }
 
+func TestGetCurrencyHistory(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	cfg, err := config.New()
+	require.NoError(t, err)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+	from := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	date := time.Date(2023, 3, 3, 0, 0, 0, 0, time.UTC)
+	expFilter := models.CurrencyHistoryFilter{CharCode: "EUR", Bucket: "week", From: &from, Limit: 10, Offset: 20}
+	expOutput := []models.CurrencyPoint{{
+		Date:      &date,
+		Nominal:   1,
+		Value:     decimal.RequireFromString("80.5"),
+		Change:    decimal.NewNullDecimal(decimal.RequireFromString("-0.5")),
+		ChangePct: decimal.NewNullDecimal(decimal.RequireFromString("-0.6173")),
+	}}
+	repo.EXPECT().GetCurrencyHistory(gomock.Any(), FiatSourceCBR, expFilter).Return(expOutput, nil).Times(1)
+	repo.EXPECT().CountCurrencyHistory(gomock.Any(), FiatSourceCBR, expFilter).Return(21, nil).Times(1)
+	params := CurrencyHistoryParams{CharCode: "eur", Interval: "1w", From: "2023-03-01", Limit: 10, Offset: 20}
+	points, page, err := srv.GetCurrencyHistory(context.Background(), params)
+	require.NoError(t, err)
+	require.Equal(t, expOutput, points)
+	require.Equal(t, 21, page.Total)
+
+	// every stored date by default
+	expFilter = models.CurrencyHistoryFilter{CharCode: "EUR", Bucket: "day"}
+	repo.EXPECT().GetCurrencyHistory(gomock.Any(), FiatSourceCBR, expFilter).Return([]models.CurrencyPoint{}, nil).Times(1)
+	repo.EXPECT().CountCurrencyHistory(gomock.Any(), FiatSourceCBR, expFilter).Return(0, nil).Times(1)
+	_, _, err = srv.GetCurrencyHistory(context.Background(), CurrencyHistoryParams{CharCode: "EUR"})
+	require.NoError(t, err)
+
+	_, _, err = srv.GetCurrencyHistory(context.Background(), CurrencyHistoryParams{CharCode: "EUR", Interval: "1h"})
+	require.ErrorIs(t, err, ErrUnexpectedInterval)
+	_, _, err = srv.GetCurrencyHistory(context.Background(), CurrencyHistoryParams{CharCode: "EUR", To: "March"})
+	require.ErrorIs(t, err, ErrUnexpectedTime)
+}
+
+func TestGetAllBTCWithTimeRange(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	cfg, err := config.New()
+	require.NoError(t, err)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+	from := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 3, 7, 0, 0, 0, 0, time.UTC)
+	expFilter := models.HistoryFilter{Offset: 5, OrderBy: "ORDER BY created_at", From: &from, To: &to}
+	repo.EXPECT().GetAllBTC(gomock.Any(), models.SymbolBTCUSDT, expFilter).Return([]models.BTC{}, nil).Times(1)
+	repo.EXPECT().CountBTC(gomock.Any(), models.SymbolBTCUSDT, expFilter).Return(0, nil).Times(1)
+	params := HistoryParams{Offset: 5, OrderBy: "created_at", From: "2023-03-01", To: "2023-03-07T00:00:00Z"}
+	_, _, err = srv.GetAllBTC(context.Background(), models.SymbolBTCUSDT, params)
+	require.NoError(t, err)
+	repo.EXPECT().GetAllFiat(gomock.Any(), FiatSourceCBR, models.HistoryFilter{From: &from}).Return([]models.Fiat{}, nil).Times(1)
+	repo.EXPECT().CountFiat(gomock.Any(), FiatSourceCBR, models.HistoryFilter{From: &from}).Return(0, nil).Times(1)
+	_, _, err = srv.GetFiatHistory(context.Background(), HistoryParams{From: "2023-03-01"}, "")
+	require.NoError(t, err)
+
+	_, _, err = srv.GetAllBTC(context.Background(), models.SymbolBTCUSDT, HistoryParams{To: "7 March"})
+	require.ErrorIs(t, err, ErrUnexpectedTime)
+}
+
 func TestGetAllBTC(t *testing.T) {
 	ctl := gomock.NewController(t)
 	defer ctl.Finish()
 	repo := mock_repository.NewMockRepositorier(ctl)
 	cfg, err := config.New()
 	require.NoError(t, err)
-	srv := NewManagementService(repo, cfg)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
 	type inoutStruct struct {
 		limit   int
 		offset  int
@@ -386,8 +659,10 @@ func TestGetAllBTC(t *testing.T) {
 	for _, c := range cases {
 		orderByAfterSerialize, err := serializeOrderBy(c.input.orderBy)
 		require.NoError(t, err)
-		repo.EXPECT().GetAllBTC(c.input.limit, c.input.offset, orderByAfterSerialize).Return([]models.BTC{}, c.expErr).Times(1)
-		_, err = srv.GetAllBTC(c.input.limit, c.input.offset, c.input.orderBy)
+		expFilter := models.HistoryFilter{Limit: c.input.limit, Offset: c.input.offset, OrderBy: orderByAfterSerialize}
+		repo.EXPECT().GetAllBTC(gomock.Any(), models.SymbolBTCUSDT, expFilter).Return([]models.BTC{}, c.expErr).Times(1)
+		repo.EXPECT().CountBTC(gomock.Any(), models.SymbolBTCUSDT, expFilter).Return(0, c.expErr).Times(1)
+		_, _, err = srv.GetAllBTC(context.Background(), models.SymbolBTCUSDT, HistoryParams{Limit: c.input.limit, Offset: c.input.offset, OrderBy: c.input.orderBy})
 		require.NoError(t, err)
 	}
 }
@@ -398,7 +673,8 @@ func TestGetAllBTCError(t *testing.T) {
 	repo := mock_repository.NewMockRepositorier(ctl)
 	cfg, err := config.New()
 	require.NoError(t, err)
-	srv := NewManagementService(repo, cfg)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
 	type inoutStruct struct {
 		limit                  int
 		offset                 int
@@ -426,9 +702,9 @@ func TestGetAllBTCError(t *testing.T) {
 	}
 	for i, c := range cases {
 		if i != 0 {
-			repo.EXPECT().GetAllBTC(c.input.limit, c.input.offset, c.input.orderByAfterSerializer).Return(c.expOutput, c.expErr).Times(1)
+			repo.EXPECT().GetAllBTC(gomock.Any(), models.SymbolBTCUSDT, models.HistoryFilter{Limit: c.input.limit, Offset: c.input.offset, OrderBy: c.input.orderByAfterSerializer}).Return(c.expOutput, c.expErr).Times(1)
 		}
-		_, err = srv.GetAllBTC(c.input.limit, c.input.offset, c.input.orderBy)
+		_, _, err = srv.GetAllBTC(context.Background(), models.SymbolBTCUSDT, HistoryParams{Limit: c.input.limit, Offset: c.input.offset, OrderBy: c.input.orderBy})
 		require.ErrorIs(t, err, c.expErr)
 	}
 }
@@ -439,10 +715,11 @@ func TestGetLastFiat(t *testing.T) {
 	repo := mock_repository.NewMockRepositorier(ctl)
 	cfg, err := config.New()
 	require.NoError(t, err)
-	srv := NewManagementService(repo, cfg)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
 	expOutput := &models.Fiat{}
-	repo.EXPECT().GetLastFiat().Return(expOutput, nil).Times(1)
-	fiat, err := srv.GetLastFiat()
+	repo.EXPECT().GetLastFiat(gomock.Any(), FiatSourceCBR, nil).Return(expOutput, nil).Times(1)
+	fiat, err := srv.GetLastFiat(context.Background(), "")
 	require.NoError(t, err)
 	require.Equal(t, expOutput, fiat)
 }
@@ -453,25 +730,63 @@ func TestGetLastFiatError(t *testing.T) {
 	repo := mock_repository.NewMockRepositorier(ctl)
 	cfg, err := config.New()
 	require.NoError(t, err)
-	srv := NewManagementService(repo, cfg)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
 	expErr := errors.New("db is off")
 	expOutput := (*models.Fiat)(nil)
-	repo.EXPECT().GetLastFiat().Return(expOutput, expErr).Times(1)
-	fiat, err := srv.GetLastFiat()
+	repo.EXPECT().GetLastFiat(gomock.Any(), FiatSourceCBR, nil).Return(expOutput, expErr).Times(1)
+	fiat, err := srv.GetLastFiat(context.Background(), "")
 	require.ErrorIs(t, err, expErr)
 	require.Equal(t, expOutput, fiat)
 }
 
+func TestCurrencySymbols(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	cfg, err := config.New()
+	require.NoError(t, err)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+	codes := []string{"USD", "EUR", "CNY"}
+	expOutput := &models.Fiat{}
+	repo.EXPECT().UnknownCurrencies(gomock.Any(), codes).Return([]string{}, nil).Times(1)
+	repo.EXPECT().GetLastFiat(gomock.Any(), FiatSourceCBR, codes).Return(expOutput, nil).Times(1)
+	fiat, err := srv.GetLastFiat(context.Background(), "usd, EUR,,CNY,USD")
+	require.NoError(t, err)
+	require.Equal(t, expOutput, fiat)
+
+	repo.EXPECT().UnknownCurrencies(gomock.Any(), []string{"RUB"}).Return([]string{}, nil).Times(1)
+	repo.EXPECT().GetAllFiat(gomock.Any(), FiatSourceCBR, models.HistoryFilter{Codes: []string{"RUB"}}).Return([]models.Fiat{}, nil).Times(1)
+	repo.EXPECT().CountFiat(gomock.Any(), FiatSourceCBR, models.HistoryFilter{Codes: []string{"RUB"}}).Return(0, nil).Times(1)
+	_, _, err = srv.GetFiatHistory(context.Background(), HistoryParams{}, "RUB")
+	require.NoError(t, err)
+
+	repo.EXPECT().UnknownCurrencies(gomock.Any(), []string{"USD", "XYZ", "ABC"}).Return([]string{"ABC", "XYZ"}, nil).Times(1)
+	_, err = srv.GetLastBTCFiat(context.Background(), models.SymbolBTCUSDT, "USD,XYZ,ABC")
+	var unknown *UnknownCurrenciesError
+	require.ErrorAs(t, err, &unknown)
+	require.Equal(t, []string{"ABC", "XYZ"}, unknown.Codes)
+	require.ErrorIs(t, err, ErrUnknownCurrency)
+
+	expBTC := &models.BTC{Symbol: models.SymbolBTCUSDT}
+	repo.EXPECT().GetLastBTCFiat(gomock.Any(), models.SymbolBTCUSDT, nil).Return(expBTC, nil).Times(1)
+	btc, err := srv.GetLastBTCFiat(context.Background(), models.SymbolBTCUSDT, " ")
+	require.NoError(t, err)
+	require.Equal(t, expBTC, btc)
+}
+
 func TestGetLastBTC(t *testing.T) {
 	ctl := gomock.NewController(t)
 	defer ctl.Finish()
 	repo := mock_repository.NewMockRepositorier(ctl)
 	cfg, err := config.New()
 	require.NoError(t, err)
-	srv := NewManagementService(repo, cfg)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
 	expOutput := &models.BTC{}
-	repo.EXPECT().GetLastBTC().Return(expOutput, nil).Times(1)
-	btc, err := srv.GetLastBTC()
+	repo.EXPECT().GetLastBTC(gomock.Any(), models.SymbolBTCUSDT).Return(expOutput, nil).Times(1)
+	btc, err := srv.GetLastBTC(context.Background(), models.SymbolBTCUSDT)
 	require.NoError(t, err)
 	require.Equal(t, expOutput, btc)
 }
@@ -482,39 +797,203 @@ func TestGetLastBTCError(t *testing.T) {
 	repo := mock_repository.NewMockRepositorier(ctl)
 	cfg, err := config.New()
 	require.NoError(t, err)
-	srv := NewManagementService(repo, cfg)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
 	expErr := errors.New("db is off")
 	expOutput := (*models.BTC)(nil)
-	repo.EXPECT().GetLastBTC().Return(expOutput, expErr).Times(1)
-	btc, err := srv.GetLastBTC()
+	repo.EXPECT().GetLastBTC(gomock.Any(), models.SymbolBTCUSDT).Return(expOutput, expErr).Times(1)
+	btc, err := srv.GetLastBTC(context.Background(), models.SymbolBTCUSDT)
 	require.ErrorIs(t, err, expErr)
 	require.Equal(t, expOutput, btc)
 }
 
-func TestCheckLastDateUpdatingFiatCurrencies(t *testing.T) {
+func TestCheckSymbol(t *testing.T) {
 	ctl := gomock.NewController(t)
 	defer ctl.Finish()
 	repo := mock_repository.NewMockRepositorier(ctl)
 	cfg, err := config.New()
 	require.NoError(t, err)
-	srv := NewManagementService(repo, cfg)
-	tm, err := time.Parse(time.RFC3339[:10], "2022-12-21")
+	cfg.Symbols = []string{"btc-usdt", " ETH-USDT"}
+	srv, err := NewManagementService(repo, cfg)
 	require.NoError(t, err)
-	repo.EXPECT().GetLastDateForFiat().Return(&tm, nil).Times(1)
-	err = srv.CheckLastDateUpdatingFiatCurrencies()
+	require.Equal(t, []string{"BTC-USDT", "ETH-USDT"}, srv.Symbols())
+	require.NoError(t, srv.CheckSymbol("ETH-USDT"))
+	require.ErrorIs(t, srv.CheckSymbol("SOL-USDT"), ErrUnknownSymbol)
+
+	cfg.Symbols = []string{"BTCUSDT"}
+	_, err = NewManagementService(repo, cfg)
+	require.Error(t, err)
+}
+
+func TestGetCandles(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	cfg, err := config.New()
+	require.NoError(t, err)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+	from := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 3, 7, 12, 0, 0, 0, time.UTC)
+	expOutput := []models.Candle{{Time: &from, Open: decimal.NewFromInt(1), High: decimal.NewFromInt(3), Low: decimal.NewFromInt(1), Close: decimal.NewFromInt(2), Count: 3}}
+	repo.EXPECT().GetCandles(gomock.Any(), models.SymbolBTCUSDT, "5 minutes", &from, &to).Return(expOutput, nil).Times(1)
+	candles, err := srv.GetCandles(context.Background(), models.SymbolBTCUSDT, "5m", "2023-03-01", "2023-03-07T12:00:00Z")
+	require.NoError(t, err)
+	require.Equal(t, expOutput, candles)
+	repo.EXPECT().GetCandles(gomock.Any(), models.SymbolBTCUSDT, "7 days", nil, nil).Return(expOutput, nil).Times(1)
+	_, err = srv.GetCandles(context.Background(), models.SymbolBTCUSDT, "1w", "", "")
 	require.NoError(t, err)
 }
 
-func TestCheckLastDateUpdatingFiatCurrenciesError(t *testing.T) {
+func TestGetCandlesError(t *testing.T) {
 	ctl := gomock.NewController(t)
 	defer ctl.Finish()
 	repo := mock_repository.NewMockRepositorier(ctl)
 	cfg, err := config.New()
 	require.NoError(t, err)
-	srv := NewManagementService(repo, cfg)
-	tm, err := time.Parse(time.RFC3339[:10], time.Now().String()[:10])
+	srv, err := NewManagementService(repo, cfg)
 	require.NoError(t, err)
-	repo.EXPECT().GetLastDateForFiat().Return(&tm, nil).Times(1)
-	err = srv.CheckLastDateUpdatingFiatCurrencies()
-	require.ErrorIs(t, err, ErrAlreadyUpdatedFiatToday)
+	_, err = srv.GetCandles(context.Background(), models.SymbolBTCUSDT, "2h", "", "")
+	require.ErrorIs(t, err, ErrUnexpectedInterval)
+	_, err = srv.GetCandles(context.Background(), models.SymbolBTCUSDT, "1h", "01.03.2023", "")
+	require.ErrorIs(t, err, ErrUnexpectedTime)
+	expErr := errors.New("db is off")
+	repo.EXPECT().GetCandles(gomock.Any(), models.SymbolBTCUSDT, "1 hour", nil, nil).Return(nil, expErr).Times(1)
+	_, err = srv.GetCandles(context.Background(), models.SymbolBTCUSDT, "1h", "", "")
+	require.ErrorIs(t, err, expErr)
+}
+
+func TestShutdown(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	cfg, err := config.New()
+	require.NoError(t, err)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+	finished := make(chan struct{})
+	srv.goWorker(func(ctx context.Context) {
+		time.Sleep(10 * time.Millisecond)
+		close(finished)
+	})
+	require.NoError(t, srv.Shutdown(context.Background()))
+	require.True(t, isClosed(finished), "Shutdown waits for the running worker")
+
+	// a worker that does not finish in time has its work canceled
+	var workErr error
+	srv.goWorker(func(ctx context.Context) {
+		<-ctx.Done()
+		workErr = ctx.Err()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, srv.Shutdown(ctx), context.DeadlineExceeded)
+	require.ErrorIs(t, workErr, context.Canceled)
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	cfg, err := config.New()
+	require.NoError(t, err)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+	expStats := &models.Stats{
+		Count:     2,
+		First:     decimal.NewNullDecimal(decimal.NewFromInt(100)),
+		Last:      decimal.NewNullDecimal(decimal.NewFromInt(110)),
+		Change:    decimal.NewNullDecimal(decimal.NewFromInt(10)),
+		ChangePct: decimal.NewNullDecimal(decimal.NewFromInt(10)),
+	}
+	repo.EXPECT().GetBTCStats(gomock.Any(), models.SymbolBTCUSDT, gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, from, to time.Time) (*models.Stats, error) {
+			require.Equal(t, 7*24*time.Hour, to.Sub(from))
+			return expStats, nil
+		}).Times(1)
+	stats, err := srv.GetBTCStats(context.Background(), models.SymbolBTCUSDT, "7d")
+	require.NoError(t, err)
+	require.Equal(t, "7d", stats.Window)
+	require.Equal(t, *expStats, stats.Stats)
+
+	// 24h by default
+	repo.EXPECT().UnknownCurrencies(gomock.Any(), []string{"EUR"}).Return([]string{}, nil).Times(1)
+	repo.EXPECT().GetCurrencyStats(gomock.Any(), FiatSourceCBR, "EUR", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _ string, from, to time.Time) (*models.Stats, error) {
+			require.Equal(t, 24*time.Hour, to.Sub(from))
+			return &models.Stats{}, nil
+		}).Times(1)
+	stats, err = srv.GetCurrencyStats(context.Background(), "eur", "")
+	require.NoError(t, err)
+	require.Equal(t, "24h", stats.Window)
+
+	repo.EXPECT().UnknownCurrencies(gomock.Any(), []string{"XYZ"}).Return([]string{"XYZ"}, nil).Times(1)
+	_, err = srv.GetCurrencyStats(context.Background(), "XYZ", "30d")
+	require.ErrorIs(t, err, ErrUnknownCurrency)
+
+	_, err = srv.GetBTCStats(context.Background(), models.SymbolBTCUSDT, "1y")
+	require.ErrorIs(t, err, ErrUnexpectedWindow)
+}
+
+func TestGetIndicator(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	repo := mock_repository.NewMockRepositorier(ctl)
+	cfg, err := config.New()
+	require.NoError(t, err)
+	srv, err := NewManagementService(repo, cfg)
+	require.NoError(t, err)
+	from := time.Date(2023, 3, 1, 3, 0, 0, 0, time.UTC)
+	candles := make([]models.Candle, 0, 5)
+	for i, c := range []string{"1", "2", "3", "4", "6"} {
+		bucket := from.Add(time.Duration(i-2) * time.Hour)
+		candles = append(candles, models.Candle{Time: &bucket, Close: decimal.RequireFromString(c)})
+	}
+	// two candles before from warm up the average of three
+	warmupFrom := from.Add(-2 * time.Hour)
+	repo.EXPECT().GetCandles(gomock.Any(), models.SymbolBTCUSDT, "1 hour", &warmupFrom, nil).Return(candles, nil).Times(1)
+	series, err := srv.GetIndicator(context.Background(), models.SymbolBTCUSDT, IndicatorParams{Type: "SMA", Period: 3, From: "2023-03-01T03:00:00Z"})
+	require.NoError(t, err)
+	require.Equal(t, "sma", series.Type)
+	require.Equal(t, "1h", series.Interval)
+	require.Len(t, series.Points, 3)
+	require.Equal(t, from, series.Points[0].Time)
+	// prices are rounded like USDT
+	requireDecimal(t, "4.33333333", series.Points[2].Value)
+
+	// drawdown has no period and no warmup
+	repo.EXPECT().GetPeakClose(gomock.Any(), models.SymbolBTCUSDT, "1 day", from).Return(decimal.NullDecimal{}, nil).Times(1)
+	repo.EXPECT().GetCandles(gomock.Any(), models.SymbolBTCUSDT, "1 day", &from, nil).Return(candles[2:], nil).Times(1)
+	series, err = srv.GetIndicator(context.Background(), models.SymbolBTCUSDT, IndicatorParams{Type: "drawdown", Interval: "1d", From: "2023-03-01T03:00:00Z"})
+	require.NoError(t, err)
+	require.Zero(t, series.Period)
+	require.Len(t, series.Points, 3)
+	requireDecimal(t, "0", series.Points[1].Value)
+
+	// the peak before from is the top of the drawdown inside the window
+	repo.EXPECT().GetPeakClose(gomock.Any(), models.SymbolBTCUSDT, "1 hour", from).Return(decimal.NewNullDecimal(decimal.NewFromInt(8)), nil).Times(1)
+	repo.EXPECT().GetCandles(gomock.Any(), models.SymbolBTCUSDT, "1 hour", &from, nil).Return(candles[2:], nil).Times(1)
+	series, err = srv.GetIndicator(context.Background(), models.SymbolBTCUSDT, IndicatorParams{Type: "drawdown", From: "2023-03-01T03:00:00Z"})
+	require.NoError(t, err)
+	require.Len(t, series.Points, 3)
+	require.Equal(t, from, series.Points[0].Time)
+	requireDecimal(t, "-0.625", series.Points[0].Value)
+	requireDecimal(t, "-0.5", series.Points[1].Value)
+	requireDecimal(t, "-0.25", series.Points[2].Value)
+
+	_, err = srv.GetIndicator(context.Background(), models.SymbolBTCUSDT, IndicatorParams{Type: "rsi"})
+	require.ErrorIs(t, err, analytics.ErrUnknownIndicator)
+	_, err = srv.GetIndicator(context.Background(), models.SymbolBTCUSDT, IndicatorParams{Type: "ema", Period: -1})
+	require.ErrorIs(t, err, analytics.ErrUnexpectedPeriod)
+	_, err = srv.GetIndicator(context.Background(), models.SymbolBTCUSDT, IndicatorParams{Type: "ema", Interval: "2h"})
+	require.ErrorIs(t, err, ErrUnexpectedInterval)
 }
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"XTechProject/cmd/config"
+	"XTechProject/internal/fetch"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	SourceKuCoin   = "kucoin"
+	SourceBinance  = "binance"
+	SourceCoinbase = "coinbase"
+	SourceKraken   = "kraken"
+)
+
+var (
+	ErrUnknownPriceSource = errors.New("unknown price source")
+	ErrUnexpectedResponse = errors.New("unexpected response from source")
+)
+
+type (
+	// PriceSource returns the last traded price for a symbol like "BTC-USDT"
+	PriceSource interface {
+		Name() string
+		GetTick(ctx context.Context, symbol string) (*Tick, error)
+		Status() fetch.Status
+	}
+	// SourceStatus is the circuit breaker state of a price or fiat source
+	SourceStatus struct {
+		Name string `json:"name"`
+		Kind string `json:"kind"`
+		fetch.Status
+	}
+	Tick struct {
+		Source string
+		Symbol string
+		// Price is kept as the exchange sends it
+		Price string
+		// Time is unix time in milliseconds
+		Time int64
+	}
+)
+
+func NewPriceSource(name string, cfg *config.Config) (PriceSource, error) {
+	switch name {
+	case SourceKuCoin:
+		return &KuCoinSource{upstream: newUpstream(name, cfg), baseURL: cfg.URLs.KuCoin}, nil
+	case SourceBinance:
+		return &BinanceSource{upstream: newUpstream(name, cfg), baseURL: cfg.URLs.Binance}, nil
+	case SourceCoinbase:
+		return &CoinbaseSource{upstream: newUpstream(name, cfg), baseURL: cfg.URLs.Coinbase}, nil
+	case SourceKraken:
+		return &KrakenSource{upstream: newUpstream(name, cfg), baseURL: cfg.URLs.Kraken}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPriceSource, name)
+	}
+}
+
+func NewPriceSources(cfg *config.Config) ([]PriceSource, error) {
+	if len(cfg.Price.Sources) == 0 {
+		return nil, fmt.Errorf("%w: no sources configured", ErrUnknownPriceSource)
+	}
+	sources := make([]PriceSource, 0, len(cfg.Price.Sources))
+	for _, name := range cfg.Price.Sources {
+		source, err := NewPriceSource(strings.TrimSpace(name), cfg)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// upstream is the client a source calls its API with
+type upstream struct {
+	client *fetch.Client
+}
+
+// newUpstream configures the client of the named source by cfg.Fetch
+func newUpstream(name string, cfg *config.Config) upstream {
+	timeout := cfg.Fetch.Timeout
+	if t, ok := cfg.Fetch.Timeouts[name]; ok {
+		timeout = t
+	}
+	return upstream{client: fetch.New(fetch.Options{
+		Timeout:         timeout,
+		Retries:         cfg.Fetch.Retries,
+		Backoff:         cfg.Fetch.Backoff,
+		MaxBackoff:      cfg.Fetch.MaxBackoff,
+		BreakerFailures: cfg.Fetch.BreakerFailures,
+		BreakerCooldown: cfg.Fetch.BreakerCooldown,
+	})}
+}
+
+// Status is the circuit breaker state of the source
+func (u upstream) Status() fetch.Status {
+	return u.client.Status()
+}
+
+// splitSymbol splits "BTC-USDT" into "BTC" and "USDT"
+func splitSymbol(symbol string) (string, string, error) {
+	base, quote, ok := strings.Cut(symbol, "-")
+	if !ok || base == "" || quote == "" {
+		return "", "", fmt.Errorf("unexpected symbol %q", symbol)
+	}
+	return base, quote, nil
+}
+
+type (
+	KuCoinSource struct {
+		upstream
+		baseURL string
+	}
+	KuCoinStatsResponse struct {
+		Code string `json:"code"`
+		Data struct {
+			Time             int64  `json:"time"`
+			Symbol           string `json:"symbol"`
+			Buy              string `json:"buy"`
+			Sell             string `json:"sell"`
+			ChangeRate       string `json:"changeRate"`
+			ChangePrice      string `json:"changePrice"`
+			High             string `json:"high"`
+			Low              string `json:"low"`
+			Vol              string `json:"vol"`
+			VolValue         string `json:"volValue"`
+			Last             string `json:"last"`
+			AveragePrice     string `json:"averagePrice"`
+			TakerFeeRate     string `json:"takerFeeRate"`
+			MakerFeeRate     string `json:"makerFeeRate"`
+			TakerCoefficient string `json:"takerCoefficient"`
+			MakerCoefficient string `json:"makerCoefficient"`
+		} `json:"data"`
+	}
+)
+
+func (s *KuCoinSource) Name() string { return SourceKuCoin }
+
+func (s *KuCoinSource) GetTick(ctx context.Context, symbol string) (*Tick, error) {
+	link := s.baseURL + "/api/v1/market/stats?symbol=" + url.QueryEscape(symbol)
+	var r KuCoinStatsResponse
+	if err := getJSON(ctx, s.client, link, &r); err != nil {
+		return nil, err
+	}
+	// KuCoin answers 200 with its own code on errors
+	if r.Code != "200000" || r.Data.Last == "" {
+		return nil, fmt.Errorf("%w: kucoin code %s", ErrUnexpectedResponse, r.Code)
+	}
+	return &Tick{Source: SourceKuCoin, Symbol: symbol, Price: r.Data.Last, Time: r.Data.Time}, nil
+}
+
+type (
+	BinanceSource struct {
+		upstream
+		baseURL string
+	}
+	BinanceTickerResponse struct {
+		Symbol    string `json:"symbol"`
+		LastPrice string `json:"lastPrice"`
+		CloseTime int64  `json:"closeTime"`
+	}
+)
+
+func (s *BinanceSource) Name() string { return SourceBinance }
+
+func (s *BinanceSource) GetTick(ctx context.Context, symbol string) (*Tick, error) {
+	base, quote, err := splitSymbol(symbol)
+	if err != nil {
+		return nil, err
+	}
+	link := s.baseURL + "/api/v3/ticker/24hr?symbol=" + url.QueryEscape(base+quote)
+	var r BinanceTickerResponse
+	if err := getJSON(ctx, s.client, link, &r); err != nil {
+		return nil, err
+	}
+	if r.LastPrice == "" {
+		return nil, fmt.Errorf("%w: binance returned empty price", ErrUnexpectedResponse)
+	}
+	return &Tick{Source: SourceBinance, Symbol: symbol, Price: r.LastPrice, Time: r.CloseTime}, nil
+}
+
+type (
+	CoinbaseSource struct {
+		upstream
+		baseURL string
+	}
+	CoinbaseTickerResponse struct {
+		Price string    `json:"price"`
+		Time  time.Time `json:"time"`
+	}
+)
+
+func (s *CoinbaseSource) Name() string { return SourceCoinbase }
+
+func (s *CoinbaseSource) GetTick(ctx context.Context, symbol string) (*Tick, error) {
+	if _, _, err := splitSymbol(symbol); err != nil {
+		return nil, err
+	}
+	link := s.baseURL + "/products/" + url.PathEscape(symbol) + "/ticker"
+	var r CoinbaseTickerResponse
+	if err := getJSON(ctx, s.client, link, &r); err != nil {
+		return nil, err
+	}
+	if r.Price == "" {
+		return nil, fmt.Errorf("%w: coinbase returned empty price", ErrUnexpectedResponse)
+	}
+	return &Tick{Source: SourceCoinbase, Symbol: symbol, Price: r.Price, Time: r.Time.UnixMilli()}, nil
+}
+
+type (
+	KrakenSource struct {
+		upstream
+		baseURL string
+	}
+	KrakenTickerResponse struct {
+		Error  []string `json:"error"`
+		Result map[string]struct {
+			// c is the last trade closed: [price, lot volume]
+			C []string `json:"c"`
+		} `json:"result"`
+	}
+)
+
+func (s *KrakenSource) Name() string { return SourceKraken }
+
+func (s *KrakenSource) GetTick(ctx context.Context, symbol string) (*Tick, error) {
+	base, quote, err := splitSymbol(symbol)
+	if err != nil {
+		return nil, err
+	}
+	// Kraken calls bitcoin XBT
+	if base == "BTC" {
+		base = "XBT"
+	}
+	link := s.baseURL + "/0/public/Ticker?pair=" + url.QueryEscape(base+quote)
+	var r KrakenTickerResponse
+	if err := getJSON(ctx, s.client, link, &r); err != nil {
+		return nil, err
+	}
+	if len(r.Error) != 0 {
+		return nil, fmt.Errorf("%w: kraken errors %s", ErrUnexpectedResponse, strings.Join(r.Error, ", "))
+	}
+	// the result is keyed by Kraken's own pair name, and we asked for one pair
+	for _, pair := range r.Result {
+		if len(pair.C) == 0 || pair.C[0] == "" {
+			break
+		}
+		// Kraken does not send the trade time
+		return &Tick{Source: SourceKraken, Symbol: symbol, Price: pair.C[0], Time: time.Now().UnixMilli()}, nil
+	}
+	return nil, fmt.Errorf("%w: kraken returned empty price", ErrUnexpectedResponse)
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"XTechProject/cmd/config"
+	"context"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestExchange(t *testing.T, path, query, body string) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, path, r.URL.Path)
+		require.Equal(t, query, r.URL.RawQuery)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestPriceSources(t *testing.T) {
+	cases := []struct {
+		name    string
+		source  func(baseURL string) PriceSource
+		path    string
+		query   string
+		body    string
+		expTick Tick
+	}{
+		{
+			name:   "kucoin",
+			source: func(baseURL string) PriceSource { return &KuCoinSource{baseURL: baseURL} },
+			path:   "/api/v1/market/stats",
+			query:  "symbol=BTC-USDT",
+			body:   `{"code":"200000","data":{"time":1671542754000,"symbol":"BTC-USDT","last":"16800.1"}}`,
+			expTick: Tick{
+				Source: SourceKuCoin, Symbol: "BTC-USDT", Price: "16800.1", Time: 1671542754000,
+			},
+		},
+		{
+			name:   "binance",
+			source: func(baseURL string) PriceSource { return &BinanceSource{baseURL: baseURL} },
+			path:   "/api/v3/ticker/24hr",
+			query:  "symbol=BTCUSDT",
+			body:   `{"symbol":"BTCUSDT","lastPrice":"16800.20000000","closeTime":1671542754001}`,
+			expTick: Tick{
+				Source: SourceBinance, Symbol: "BTC-USDT", Price: "16800.20000000", Time: 1671542754001,
+			},
+		},
+		{
+			name:   "coinbase",
+			source: func(baseURL string) PriceSource { return &CoinbaseSource{baseURL: baseURL} },
+			path:   "/products/BTC-USDT/ticker",
+			query:  "",
+			body:   `{"price":"16800.3","time":"2022-12-20T13:25:54.002Z"}`,
+			expTick: Tick{
+				Source: SourceCoinbase, Symbol: "BTC-USDT", Price: "16800.3", Time: 1671542754002,
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			source := c.source(newTestExchange(t, c.path, c.query, c.body))
+			tick, err := source.GetTick(context.Background(), "BTC-USDT")
+			require.NoError(t, err)
+			require.Equal(t, c.expTick, *tick)
+			require.Equal(t, c.name, source.Name())
+		})
+	}
+}
+
+func TestKrakenSource(t *testing.T) {
+	body := `{"error":[],"result":{"XBTUSDT":{"c":["16800.4","0.01"]}}}`
+	source := &KrakenSource{baseURL: newTestExchange(t, "/0/public/Ticker", "pair=XBTUSDT", body)}
+	tick, err := source.GetTick(context.Background(), "BTC-USDT")
+	require.NoError(t, err)
+	require.Equal(t, SourceKraken, tick.Source)
+	require.Equal(t, "16800.4", tick.Price)
+	require.NotZero(t, tick.Time)
+}
+
+func TestPriceSourcesError(t *testing.T) {
+	cases := []struct {
+		name   string
+		source func(baseURL string) PriceSource
+		body   string
+	}{
+		{
+			name:   "kucoin with error code",
+			source: func(baseURL string) PriceSource { return &KuCoinSource{baseURL: baseURL} },
+			body:   `{"code":"900001","msg":"Symbol [BTC-USDT] Not Exists"}`,
+		},
+		{
+			name:   "binance with empty price",
+			source: func(baseURL string) PriceSource { return &BinanceSource{baseURL: baseURL} },
+			body:   `{"code":-1121,"msg":"Invalid symbol."}`,
+		},
+		{
+			name:   "coinbase with empty price",
+			source: func(baseURL string) PriceSource { return &CoinbaseSource{baseURL: baseURL} },
+			body:   `{"message":"NotFound"}`,
+		},
+		{
+			name:   "kraken with errors",
+			source: func(baseURL string) PriceSource { return &KrakenSource{baseURL: baseURL} },
+			body:   `{"error":["EQuery:Unknown asset pair"]}`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(c.body))
+			}))
+			defer srv.Close()
+			_, err := c.source(srv.URL).GetTick(context.Background(), "BTC-USDT")
+			require.ErrorIs(t, err, ErrUnexpectedResponse)
+		})
+	}
+}
+
+func TestNewPriceSource(t *testing.T) {
+	cfg, err := config.New()
+	require.NoError(t, err)
+	for _, name := range []string{SourceKuCoin, SourceBinance, SourceCoinbase, SourceKraken} {
+		source, err := NewPriceSource(name, cfg)
+		require.NoError(t, err)
+		require.Equal(t, name, source.Name())
+	}
+	_, err = NewPriceSource("wrong", cfg)
+	require.ErrorIs(t, err, ErrUnknownPriceSource)
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"XTechProject/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrUnexpectedWindow = errors.New("unexpected window")
+
+// defaultStatsWindow is used when a stats request has no window
+const defaultStatsWindow = "24h"
+
+// statsWindows are the windows stats can be computed over
+var statsWindows = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+// Stats are the aggregates of the window that ends at To
+type Stats struct {
+	Window string    `json:"window"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	models.Stats
+}
+
+// GetBTCStats aggregates the prices of the pair over the window until now
+func (svc *ManagementService) GetBTCStats(ctx context.Context, symbol, window string) (*Stats, error) {
+	res, err := newStats(window, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	stats, err := svc.db.GetBTCStats(ctx, symbol, res.From, res.To)
+	if err != nil {
+		return nil, fmt.Errorf("error in GetBTCStats: %w", err)
+	}
+	res.Stats = *stats
+	return res, nil
+}
+
+// GetCurrencyStats aggregates the values of a currency of the primary source that were in effect over the window.
+// The window is counted in effective dates of the source.
+func (svc *ManagementService) GetCurrencyStats(ctx context.Context, charCode, window string) (*Stats, error) {
+	source := svc.primaryFiatSource()
+	res, err := newStats(window, time.Now().In(fiatLocation(source)))
+	if err != nil {
+		return nil, err
+	}
+	// unknown codes are the same 400 as of the symbols filters
+	codes, err := svc.currencyCodes(ctx, charCode)
+	if err != nil {
+		return nil, err
+	}
+	if len(codes) != 1 {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCurrency, charCode)
+	}
+	stats, err := svc.db.GetCurrencyStats(ctx, source, codes[0], res.From, res.To)
+	if err != nil {
+		return nil, fmt.Errorf("error in GetCurrencyStats: %w", err)
+	}
+	res.Stats = *stats
+	return res, nil
+}
+
+// newStats checks the window and returns its empty stats that end at to
+func newStats(window string, to time.Time) (*Stats, error) {
+	if window == "" {
+		window = defaultStatsWindow
+	}
+	d, ok := statsWindows[window]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q, use 24h, 7d or 30d", ErrUnexpectedWindow, window)
+	}
+	return &Stats{Window: window, From: to.Add(-d), To: to}, nil
+}
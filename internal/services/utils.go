@@ -1,48 +1,143 @@
 package services
 
 import (
+	"XTechProject/internal/fetch"
 	"XTechProject/internal/models"
+	"context"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"github.com/shopspring/decimal"
+	"golang.org/x/net/html/charset"
 	"golang.org/x/sync/errgroup"
+	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
-func calculateBTCToFiat(currencies []models.Currency, btcInRub float64) (map[string]float64, error) {
-	btcToFiat := make(map[string]float64, 34)
+// calculateBTCToFiat converts btcInBase into every currency priced in the base currency,
+// the amounts are rounded by precision
+func calculateBTCToFiat(currencies []models.Currency, base string, btcInBase decimal.Decimal, precision Precision) (map[string]decimal.Decimal, error) {
+	btcToFiat := make(map[string]decimal.Decimal, 34)
 	for _, c := range currencies {
-		btcToFiat[c.CharCode] = btcInRub / c.Val * float64(c.Nominal)
+		if !c.Val.IsPositive() || c.Nominal <= 0 {
+			return nil, fmt.Errorf("unexpected value %s for %d %s", c.Val, c.Nominal, c.CharCode)
+		}
+		// multiplying first keeps the result exact for nominals like 100 JPY
+		btcToFiat[c.CharCode] = precision.Round(c.CharCode, false, btcInBase.Mul(decimal.NewFromInt(int64(c.Nominal))).Div(c.Val))
 	}
-	btcToFiat["RUB"] = btcInRub
+	btcToFiat[base] = precision.Round(base, false, btcInBase)
 	return btcToFiat, nil
 }
 
-func getResponse(link string) (*http.Response, error) {
+// aggregateTicks returns the median of the quotes that are within maxDeviation of the median of all quotes.
+// Every tick is returned as a quote, rejected ones with Accepted=false.
+func aggregateTicks(ticks []*Tick, maxDeviation float64, minSources int) (decimal.Decimal, int64, []models.SourceQuote, error) {
+	quotes := make([]models.SourceQuote, 0, len(ticks))
+	prices := make([]decimal.Decimal, 0, len(ticks))
+	for _, t := range ticks {
+		price, err := decimal.NewFromString(t.Price)
+		if err != nil {
+			log.Printf("error in decimal.NewFromString(%s) from %s, err %s\n", t.Price, t.Source, err)
+			continue
+		}
+		quotes = append(quotes, models.SourceQuote{
+			Source:    t.Source,
+			Price:     price,
+			CreatedAt: unixTimeToTime(t.Time),
+		})
+		prices = append(prices, price)
+	}
+	if len(prices) == 0 {
+		return decimal.Zero, 0, nil, fmt.Errorf("%w: got 0", ErrNotEnoughQuotes)
+	}
+	mid := median(prices)
+	deviation := decimal.NewFromFloat(maxDeviation)
+	var (
+		accepted []decimal.Decimal
+		unixTime int64
+	)
+	for i := range quotes {
+		if mid.IsZero() || quotes[i].Price.Sub(mid).Abs().Div(mid).GreaterThan(deviation) {
+			continue
+		}
+		quotes[i].Accepted = true
+		accepted = append(accepted, quotes[i].Price)
+		if t := quotes[i].CreatedAt.UnixMilli(); t > unixTime {
+			unixTime = t
+		}
+	}
+	if len(accepted) < minSources || len(accepted) == 0 {
+		return decimal.Zero, 0, nil, fmt.Errorf("%w: accepted %d of %d, need %d", ErrNotEnoughQuotes, len(accepted), len(quotes), minSources)
+	}
+	return median(accepted), unixTime, quotes, nil
+}
+
+func median(values []decimal.Decimal) decimal.Decimal {
+	sorted := make([]decimal.Decimal, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].LessThan(sorted[j]) })
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	// half of a sum is exact
+	return sorted[n/2-1].Add(sorted[n/2]).Mul(decimal.New(5, -1))
+}
+
+func getResponse(ctx context.Context, client *fetch.Client, link string) (*http.Response, error) {
 	// NOTE: need to close resp
-	resp, err := http.Get(link)
+	return client.Get(ctx, link)
+}
+
+func getJSON(ctx context.Context, client *fetch.Client, link string, v interface{}) error {
+	response, err := getResponse(ctx, client, link)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			log.Printf("error in response.Body.Close(), err: %s", err.Error())
+		}
+	}()
+	if err := json.NewDecoder(response.Body).Decode(v); err != nil {
+		return fmt.Errorf("error in json.Decode, err: %w", err)
+	}
+	return nil
+}
+
+func getXML(ctx context.Context, client *fetch.Client, link string, v interface{}) error {
+	response, err := getResponse(ctx, client, link)
 	if err != nil {
-		return nil, fmt.Errorf("http.Get() err: %w", err)
+		return err
 	}
-	// Success is indicated with 2xx status codes:
-	statusOK := resp.StatusCode >= 200 && resp.StatusCode < 300
-	if !statusOK {
-		return nil, fmt.Errorf("http.Get() status code: %d", resp.StatusCode)
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			log.Printf("error in response.Body.Close(), err: %s", err.Error())
+		}
+	}()
+	decoder := xml.NewDecoder(response.Body)
+	// CBR answers in windows-1251
+	decoder.CharsetReader = charset.NewReaderLabel
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("error in decoder.Decode, err: %w", err)
 	}
-	return resp, nil
+	return nil
 }
 
-func serializeFiatCurrenciesData(val []Valute) ([]byte, float64, error) {
+// serializeFiatCurrenciesData parses the CBR values exactly, they have a decimal comma
+func serializeFiatCurrenciesData(val []Valute) ([]byte, decimal.Decimal, error) {
 	if len(val) == 0 {
-		return nil, 0, ErrEmptyValuteSlice
+		return nil, decimal.Zero, ErrEmptyValuteSlice
 	}
 	var (
 		mu     = &sync.Mutex{}
 		errs   = &errgroup.Group{}
-		usdrub float64
+		usdrub decimal.Decimal
 	)
 	cur := make([]models.Currency, 0, len(val))
 	for _, v := range val {
@@ -52,14 +147,14 @@ func serializeFiatCurrenciesData(val []Valute) ([]byte, float64, error) {
 				if err != nil {
 					return err
 				}
-				value, err := strconv.ParseFloat(strings.Replace(valute.Value, ",", ".", 1), 64)
+				value, err := decimal.NewFromString(strings.Replace(valute.Value, ",", ".", 1))
 				if err != nil {
-					return err
+					return &strconv.NumError{Func: "NewFromString", Num: valute.Value, Err: strconv.ErrSyntax}
 				}
+				mu.Lock()
 				if valute.CharCode == models.CharCodeUSD {
 					usdrub = value
 				}
-				mu.Lock()
 				cur = append(cur, models.Currency{
 					ID:       valute.ID,
 					Name:     valute.Name,
@@ -74,14 +169,14 @@ func serializeFiatCurrenciesData(val []Valute) ([]byte, float64, error) {
 		}(v)
 	}
 	if err := errs.Wait(); err != nil {
-		return nil, 0, err
+		return nil, decimal.Zero, err
 	}
-	if usdrub == 0 {
-		return nil, 0, ErrUSDNotFound
+	if usdrub.IsZero() {
+		return nil, decimal.Zero, ErrUSDNotFound
 	}
 	bts, err := json.Marshal(cur)
 	if err != nil {
-		return nil, 0, err
+		return nil, decimal.Zero, err
 	}
 	return bts, usdrub, nil
 }
@@ -89,9 +184,9 @@ func serializeFiatCurrenciesData(val []Valute) ([]byte, float64, error) {
 func serializeOrderBy(orderBy string) (string, error) {
 	if orderBy != "" {
 		switch orderBy {
-		case "value", "created_at", "latest":
+		case "value", "created_at", "effective_date", "latest":
 			orderBy = "ORDER BY " + orderBy
-		case "-value", "-created_at", "-latest":
+		case "-value", "-created_at", "-effective_date", "-latest":
 			orderBy = "ORDER BY " + orderBy[1:] + " DESC"
 		default:
 			return "", ErrUnexpectedOrderBy
@@ -100,6 +195,51 @@ func serializeOrderBy(orderBy string) (string, error) {
 	return orderBy, nil
 }
 
+// serializeInterval turns a candle interval into a postgres interval
+func serializeInterval(interval string) (string, error) {
+	switch interval {
+	case "1m":
+		return "1 minute", nil
+	case "5m":
+		return "5 minutes", nil
+	case "1h":
+		return "1 hour", nil
+	case "1d":
+		return "1 day", nil
+	case "1w":
+		return "7 days", nil
+	default:
+		return "", fmt.Errorf("%w: %q, use 1m, 5m, 1h, 1d or 1w", ErrUnexpectedInterval, interval)
+	}
+}
+
+// serializeBucket turns a currency history interval into a date_trunc field, rates change at most daily
+func serializeBucket(interval string) (string, error) {
+	switch interval {
+	case "", "1d":
+		return "day", nil
+	case "1w":
+		return "week", nil
+	case "1M":
+		return "month", nil
+	default:
+		return "", fmt.Errorf("%w: %q, use 1d, 1w or 1M", ErrUnexpectedInterval, interval)
+	}
+}
+
+// parseTime parses RFC3339 or a date, an empty value is nil
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.RFC3339[:10]} {
+		if tm, err := time.Parse(layout, value); err == nil {
+			return &tm, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnexpectedTime, value)
+}
+
 func unixTimeToTime(unixTime int64) *time.Time {
 	tm := time.Unix(0, unixTime*int64(time.Millisecond))
 	return &tm
@@ -2,131 +2,194 @@ package services
 
 import (
 	"XTechProject/internal/models"
-	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
-	"encoding/xml"
-	"golang.org/x/net/html/charset"
-	"io"
-	"io/ioutil"
+	"errors"
+	"fmt"
 	"log"
+	"sync"
+	"time"
 )
 
-type BTCUSDTResponse struct {
-	Code string `json:"code"`
-	Data struct {
-		Time             int64  `json:"time"`
-		Symbol           string `json:"symbol"`
-		Buy              string `json:"buy"`
-		Sell             string `json:"sell"`
-		ChangeRate       string `json:"changeRate"`
-		ChangePrice      string `json:"changePrice"`
-		High             string `json:"high"`
-		Low              string `json:"low"`
-		Vol              string `json:"vol"`
-		VolValue         string `json:"volValue"`
-		Last             string `json:"last"`
-		AveragePrice     string `json:"averagePrice"`
-		TakerFeeRate     string `json:"takerFeeRate"`
-		MakerFeeRate     string `json:"makerFeeRate"`
-		TakerCoefficient string `json:"takerCoefficient"`
-		MakerCoefficient string `json:"makerCoefficient"`
-	} `json:"data"`
-}
-
-var lastPrice string
-
-func (svc *ManagementService) BTCWorker() {
+func (svc *ManagementService) BTCWorker(ctx context.Context) {
 	log.Println("BTCWorker triggered")
-	response, err := getResponse(svc.cfg.URLs.BTCUSDT)
-	if err != nil {
-		log.Printf("BTCWorker: error in getResponse, err: %s", err.Error())
-		return
+	wg := &sync.WaitGroup{}
+	for _, s := range svc.symbols {
+		wg.Add(1)
+		go func(symbol string) {
+			defer wg.Done()
+			svc.updateSymbol(ctx, symbol)
+		}(s)
 	}
-	body, err := io.ReadAll(response.Body)
+	wg.Wait()
+}
+
+func (svc *ManagementService) updateSymbol(ctx context.Context, symbol string) {
+	ticks := svc.pollPriceSources(ctx, symbol)
+	price, unixTime, quotes, err := aggregateTicks(ticks, svc.cfg.Price.MaxDeviation, svc.cfg.Price.MinSources)
 	if err != nil {
-		log.Printf("BTCWorker: error in io.ReadAll, err: %s", err.Error())
+		log.Printf("BTCWorker: error in aggregateTicks for %s, err: %s", symbol, err.Error())
 		return
 	}
-	defer func() {
-		if err := response.Body.Close(); err != nil {
-			log.Printf("error in response.Body.Close(), err: %s", err.Error())
-		}
-	}()
-	var r *BTCUSDTResponse
-	if err := json.Unmarshal(body, &r); err != nil {
-		log.Printf("BTCWorker: error in json.Unmarshal, err: %s", err.Error())
-	}
-	if lastPrice != r.Data.Last {
-		lastPrice = r.Data.Last
+	value := price.String()
+	svc.lastPricesMu.Lock()
+	changed := svc.lastPrices[symbol] != value
+	svc.lastPrices[symbol] = value
+	svc.lastPricesMu.Unlock()
+	if changed {
 		// create new record
-		go svc.UpdateBTCInDB(r.Data.Time, r.Data.Last)
+		svc.UpdateBTCInDB(ctx, symbol, unixTime, value, quotes)
 	}
 }
 
-type (
-	ValCurs struct {
-		XMLName xml.Name `xml:"ValCurs"`
-		Date    string   `xml:"Date,attr"`
-		Name    string   `xml:"name,attr"`
-		Valutes []Valute `xml:"Valute"`
-	}
-	Valute struct {
-		ID       string `xml:"ID,attr"`
-		NumCode  string `xml:"NumCode"`
-		CharCode string `xml:"CharCode"`
-		Nominal  string `xml:"Nominal"`
-		Name     string `xml:"Name"`
-		Value    string `xml:"Value"`
+// pollPriceSources asks all sources at once, failed sources are logged and skipped
+func (svc *ManagementService) pollPriceSources(ctx context.Context, symbol string) []*Tick {
+	var (
+		mu    = &sync.Mutex{}
+		wg    = &sync.WaitGroup{}
+		ticks = make([]*Tick, 0, len(svc.prices))
+	)
+	for _, s := range svc.prices {
+		wg.Add(1)
+		go func(source PriceSource) {
+			defer wg.Done()
+			tick, err := source.GetTick(ctx, symbol)
+			if err != nil {
+				log.Printf("BTCWorker: error in GetTick from %s, err: %s", source.Name(), err.Error())
+				return
+			}
+			mu.Lock()
+			ticks = append(ticks, tick)
+			mu.Unlock()
+		}(s)
 	}
-)
+	wg.Wait()
+	return ticks
+}
 
-func (svc *ManagementService) FiatWorker() {
+func (svc *ManagementService) FiatWorker(ctx context.Context) {
 	log.Println("FiatWorker triggered")
-	// if there is data today -> stop
-	if err := svc.CheckLastDateUpdatingFiatCurrencies(); err != nil {
-		log.Printf("FiatWorker: error in checkLastDateUpdatingFiatCurrencies: %s", err.Error())
-		return
+	for _, source := range svc.fiats {
+		svc.UpdateFiatInDB(ctx, source)
 	}
-	response, err := getResponse(svc.cfg.URLs.Fiat)
+}
+
+func (svc *ManagementService) UpdateFiatInDB(ctx context.Context, source FiatSource) {
+	model, err := source.GetFiat(ctx)
 	if err != nil {
-		log.Printf("FiatWorker: error in getResponse from %s, err: %s\n", svc.cfg.URLs.Fiat, err.Error())
+		log.Printf("FiatWorker: error in GetFiat from %s, err: %s\n", source.Name(), err.Error())
 		return
 	}
-	defer func() {
-		if err := response.Body.Close(); err != nil {
-			log.Printf("error in response.Body.Close(), err: %s", err.Error())
-		}
-	}()
-	data, err := ioutil.ReadAll(response.Body)
+	// rates of a stored effective date are skipped, the latest flag moves in the same transaction
+	created, err := svc.db.CreateLatestFiatRecord(ctx, model)
 	if err != nil {
-		log.Printf("FiatWorker: error in ioutil.ReadAll, err: %s\n", err.Error())
+		log.Printf("FiatWorker: error in CreateLatestFiatRecord, err: %s\n", err.Error())
 		return
 	}
-	decoder := xml.NewDecoder(bytes.NewReader(data))
-	decoder.CharsetReader = charset.NewReaderLabel
-	var val ValCurs
-	if err := decoder.Decode(&val); err != nil {
-		log.Printf("FiatWorker: error in decoder.Decode, err: %s\n", err.Error())
+	if !created {
+		log.Printf("Fiat from %s for %s is already stored\n", source.Name(), model.EffectiveDate.Format(time.RFC3339[:10]))
 		return
 	}
-	currencies, usdrub, err := serializeFiatCurrenciesData(val.Valutes)
-	model := &models.Fiat{
-		Latest: true,
-		USDRUB: usdrub,
+	log.Printf("Fiat from %s for %s updated in db\n", source.Name(), model.EffectiveDate.Format(time.RFC3339[:10]))
+	if source.Name() != svc.primaryFiatSource() {
+		return
 	}
-	if err = json.Unmarshal(currencies, &model.Currencies); err != nil {
-		log.Printf("FiatWorker: error in json.Unmarshal, err: %s\n", err.Error())
+	// CBR publishes the rates of the next working day, EffectiveFiatWorker applies them when that day starts
+	if model.EffectiveDate.After(fiatDate(source.Name(), time.Now())) {
+		log.Printf("Fiat from %s takes effect on %s, BTC/Fiat is recalculated then\n", source.Name(), model.EffectiveDate.Format(time.RFC3339[:10]))
+		return
+	}
+	svc.RecalculateBTCToFiat(ctx, model)
+}
+
+// EffectiveFiatWorker runs when a day starts in the timezone of the primary source
+// and recalculates BTC/Fiat if rates stored before take effect on it
+func (svc *ManagementService) EffectiveFiatWorker(ctx context.Context) {
+	log.Println("EffectiveFiatWorker triggered")
+	svc.applyEffectiveFiat(ctx, fiatDate(svc.primaryFiatSource(), time.Now()))
+}
+
+// applyEffectiveFiat recalculates BTC/Fiat with the rates of the primary source that take effect on date
+func (svc *ManagementService) applyEffectiveFiat(ctx context.Context, date time.Time) {
+	source := svc.primaryFiatSource()
+	fiat, err := svc.db.GetFiatAsOf(ctx, source, date)
+	if errors.Is(err, sql.ErrNoRows) {
 		return
 	}
-	// set old data as latest=false
-	if err := svc.db.SetAllRecordsFiatLatestFalse(); err != nil {
-		log.Printf("FiatWorker: error in SetAllRecordsFiatLatestFalse, err: %s\n", err.Error())
+	if err != nil {
+		log.Printf("EffectiveFiatWorker: error in GetFiatAsOf from %s, err: %s\n", source, err.Error())
 		return
 	}
-	// create a new record for fiat currencies
-	if err = svc.db.CreateFiatRecord(model); err != nil {
-		log.Printf("FiatWorker:error in CreateFiatRecord, err: %s\n", err.Error())
+	// on days without new rates the previous ones stay in effect and the prices don't change
+	if !fiat.EffectiveDate.Equal(date) {
 		return
 	}
-	log.Println("Fiat updated in db")
+	svc.RecalculateBTCToFiat(ctx, fiat)
+}
+
+// RecalculateBTCToFiat prices the latest record of every symbol again when new rates of the primary source
+// take effect, the BTC worker only writes when the price moves. The latest record is the current price,
+// so it gets the new rates even if it was stored before their effective date. With Fiat.ReprocessDay
+// all records of the effective date of the rates are priced with them as well.
+func (svc *ManagementService) RecalculateBTCToFiat(ctx context.Context, fiat *models.Fiat) {
+	for _, symbol := range svc.symbols {
+		if svc.cfg.Fiat.ReprocessDay {
+			if err := svc.reprocessFiatDay(ctx, symbol, fiat); err != nil {
+				log.Printf("FiatWorker: error in reprocessFiatDay for %s, err: %s\n", symbol, err.Error())
+			}
+		}
+		btc, err := svc.db.GetLastBTC(ctx, symbol)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			log.Printf("FiatWorker: error in GetLastBTC for %s, err: %s\n", symbol, err.Error())
+			continue
+		}
+		if err := svc.repriceLastBTC(ctx, btc, fiat); err != nil {
+			log.Printf("FiatWorker: error in repriceLastBTC for %s, err: %s\n", symbol, err.Error())
+		}
+	}
+}
+
+// repriceLastBTC prices the latest record with the rates and stores its BTC/Fiat
+func (svc *ManagementService) repriceLastBTC(ctx context.Context, btc *models.BTC, fiat *models.Fiat) error {
+	btcToFiat, err := svc.priceInFiat(btc, fiat)
+	if err != nil {
+		return err
+	}
+	if btc.BTCToFiat, err = json.Marshal(btcToFiat); err != nil {
+		return fmt.Errorf("error in json.Marshal(btcToFiat), err: %w", err)
+	}
+	if err = svc.db.UpdateFiatForLastBTC(ctx, btc); err != nil {
+		return fmt.Errorf("error in UpdateFiatForLastBTC(btc), err: %w", err)
+	}
+	log.Printf("%s/Fiat updated in db\n", btc.Symbol)
+	return nil
+}
+
+// reprocessFiatDay prices the records of the symbol from the effective day of the rates in their source timezone
+func (svc *ManagementService) reprocessFiatDay(ctx context.Context, symbol string, fiat *models.Fiat) error {
+	date := fiat.EffectiveDate
+	from := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, fiatLocation(fiat.Source))
+	to := from.AddDate(0, 0, 1)
+	records, err := svc.db.GetAllBTC(ctx, symbol, models.HistoryFilter{From: &from, To: &to})
+	if err != nil {
+		return fmt.Errorf("error in GetAllBTC: %w", err)
+	}
+	for i := range records {
+		btcToFiat, err := svc.priceInFiat(&records[i], fiat)
+		if err != nil {
+			return err
+		}
+		if records[i].BTCToFiat, err = json.Marshal(btcToFiat); err != nil {
+			return fmt.Errorf("error in json.Marshal(btcToFiat), err: %w", err)
+		}
+	}
+	if err := svc.db.UpdateFiatForBTCRecords(ctx, records); err != nil {
+		return fmt.Errorf("error in UpdateFiatForBTCRecords: %w", err)
+	}
+	log.Printf("%s/Fiat of %d record(s) for %s updated in db\n", symbol, len(records), date.Format(time.RFC3339[:10]))
+	return nil
 }
@@ -0,0 +1,215 @@
+// Package migrate applies versioned SQL migrations and keeps track of them in the schema_migrations table.
+//
+// Migrations are files named 0001_create_table.up.sql and 0001_create_table.down.sql,
+// every migration runs in its own transaction.
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// lockID is the advisory lock that keeps two instances from migrating at once
+const lockID = 7_202_301
+
+var (
+	ErrNoMigrations   = errors.New("no migrations")
+	ErrBadFileName    = errors.New("unexpected migration file name")
+	ErrNoUp           = errors.New("migration has no up file")
+	ErrNoDown         = errors.New("migration has no down file")
+	ErrUnknownVersion = errors.New("database has a migration that is not known")
+	ErrNothingToDown  = errors.New("no applied migrations")
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type (
+	Migration struct {
+		Version int
+		Name    string
+		Up      string
+		Down    string
+	}
+	Migrator struct {
+		db         *sqlx.DB
+		migrations []Migration
+	}
+)
+
+func New(db *sqlx.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Load reads the migrations from the root of fsys sorted by version
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		match := fileName.FindStringSubmatch(f.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%w: %s", ErrBadFileName, f.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("%w: %s, version %d is %s", ErrBadFileName, f.Name(), version, m.Name)
+		}
+		body, err := fs.ReadFile(fsys, f.Name())
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+	if len(byVersion) == 0 {
+		return nil, ErrNoMigrations
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("%w: %04d_%s", ErrNoUp, m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Version is the last applied migration, 0 for an empty database
+func (m *Migrator) Version() (int, error) {
+	if err := m.createTable(); err != nil {
+		return 0, err
+	}
+	var version int
+	err := m.db.Get(&version, `SELECT coalesce(max(version), 0) FROM schema_migrations`)
+	return version, err
+}
+
+// Pending returns the migrations that are not applied yet
+func (m *Migrator) Pending() ([]Migration, error) {
+	version, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+	if version > m.Latest() {
+		return nil, fmt.Errorf("%w: database is at %d, latest known is %d", ErrUnknownVersion, version, m.Latest())
+	}
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Latest is the version of the last known migration
+func (m *Migrator) Latest() int {
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies all pending migrations and returns them
+func (m *Migrator) Up() ([]Migration, error) {
+	pending, err := m.Pending()
+	if err != nil {
+		return nil, err
+	}
+	for i, migration := range pending {
+		if err := m.apply(migration, true); err != nil {
+			return pending[:i], fmt.Errorf("error in migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+// Down rolls back the last applied migration and returns it
+func (m *Migrator) Down() (*Migration, error) {
+	version, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		return nil, ErrNothingToDown
+	}
+	for _, migration := range m.migrations {
+		if migration.Version != version {
+			continue
+		}
+		if migration.Down == "" {
+			return nil, fmt.Errorf("%w: %04d_%s", ErrNoDown, migration.Version, migration.Name)
+		}
+		if err := m.apply(migration, false); err != nil {
+			return nil, fmt.Errorf("error in migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		return &migration, nil
+	}
+	return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+}
+
+func (m *Migrator) createTable() error {
+	_, err := m.db.Exec(`CREATE TABLE if not exists schema_migrations
+	(
+		version    bigint                   primary key,
+		name       text                     not null,
+		applied_at timestamp with time zone not null default CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+func (m *Migrator) apply(migration Migration, up bool) error {
+	tx, err := m.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec(`SELECT pg_advisory_xact_lock($1)`, lockID); err != nil {
+		return err
+	}
+	// another instance could have applied it while we were waiting for the lock
+	var applied bool
+	if err = tx.Get(&applied, `SELECT exists(SELECT 1 FROM schema_migrations WHERE version = $1)`, migration.Version); err != nil {
+		return err
+	}
+	if applied == up {
+		return nil
+	}
+	if up {
+		_, err = tx.Exec(migration.Up)
+	} else {
+		_, err = tx.Exec(migration.Down)
+	}
+	if err != nil {
+		return err
+	}
+	if up {
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name)
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,39 @@
+package migrate
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_index.up.sql":   {Data: []byte("CREATE INDEX i ON t (a)")},
+		"0002_add_index.down.sql": {Data: []byte("DROP INDEX i")},
+		"0001_init.up.sql":        {Data: []byte("CREATE TABLE t (a int)")},
+		"0010_no_down.up.sql":     {Data: []byte("ALTER TABLE t ADD COLUMN b int")},
+	}
+	migrations, err := Load(fsys)
+	require.NoError(t, err)
+	require.Equal(t, []Migration{
+		{Version: 1, Name: "init", Up: "CREATE TABLE t (a int)"},
+		{Version: 2, Name: "add_index", Up: "CREATE INDEX i ON t (a)", Down: "DROP INDEX i"},
+		{Version: 10, Name: "no_down", Up: "ALTER TABLE t ADD COLUMN b int"},
+	}, migrations)
+}
+
+func TestLoadError(t *testing.T) {
+	cases := []struct {
+		fsys fstest.MapFS
+		err  error
+	}{
+		{fstest.MapFS{}, ErrNoMigrations},
+		{fstest.MapFS{"init.sql": {}}, ErrBadFileName},
+		{fstest.MapFS{"0001_init.up.sql": {Data: []byte("1")}, "0001_other.down.sql": {Data: []byte("2")}}, ErrBadFileName},
+		{fstest.MapFS{"0001_init.down.sql": {Data: []byte("DROP TABLE t")}}, ErrNoUp},
+	}
+	for _, c := range cases {
+		_, err := Load(c.fsys)
+		require.ErrorIs(t, err, c.err)
+	}
+}